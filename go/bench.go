@@ -0,0 +1,159 @@
+package main
+
+import (
+	"dagger/go/internal/dagger"
+	"strconv"
+)
+
+const benchOutputPath = "/work/bench.txt"
+
+// Run benchmarks and return the raw output (in the format expected by benchstat).
+func (m *WithSource) Bench(
+	// Packages to benchmark.
+	//
+	// +optional
+	// +default=["./..."]
+	packages []string,
+
+	// Run only those benchmarks matching the regular expression.
+	//
+	// +optional
+	// +default="."
+	bench string,
+
+	// Run each benchmark n times.
+	//
+	// +optional
+	count int,
+
+	// Run enough iterations of each benchmark to take the specified duration (e.g., "1s", "100x").
+	//
+	// +optional
+	benchtime string,
+
+	// Print memory allocation statistics for benchmarks.
+	//
+	// +optional
+	benchmem bool,
+) *dagger.File {
+	return m.Container().
+		WithExec(benchArgs(packages, bench, count, benchtime, benchmem), dagger.ContainerWithExecOpts{
+			RedirectStdout: benchOutputPath,
+		}).
+		File(benchOutputPath)
+}
+
+func benchArgs(packages []string, bench string, count int, benchtime string, benchmem bool) []string {
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+
+	if bench == "" {
+		bench = "."
+	}
+
+	args := []string{"go", "test", "-run", "^$", "-bench", bench}
+
+	if count > 0 {
+		args = append(args, "-count", strconv.Itoa(count))
+	}
+
+	if benchtime != "" {
+		args = append(args, "-benchtime", benchtime)
+	}
+
+	if benchmem {
+		args = append(args, "-benchmem")
+	}
+
+	return append(args, packages...)
+}
+
+// Run benchmarks on two versions of the source and compare the results using benchstat.
+//
+// The benchmarks run one after the other (not in parallel) to reduce noise.
+func (m *Go) CompareBench(
+	// Source directory of the baseline (e.g., the target branch of a pull request).
+	base *dagger.Directory,
+
+	// Source directory to compare to the baseline (e.g., the head of a pull request).
+	head *dagger.Directory,
+
+	// Packages to benchmark.
+	//
+	// +optional
+	// +default=["./..."]
+	packages []string,
+
+	// Run only those benchmarks matching the regular expression.
+	//
+	// +optional
+	// +default="."
+	bench string,
+
+	// Run each benchmark n times (benchstat needs multiple samples to compute significance).
+	//
+	// +optional
+	// +default=6
+	count int,
+
+	// Run enough iterations of each benchmark to take the specified duration (e.g., "1s", "100x").
+	//
+	// +optional
+	benchtime string,
+
+	// Print memory allocation statistics for benchmarks.
+	//
+	// +optional
+	benchmem bool,
+
+	// Version of benchstat to use.
+	//
+	// +optional
+	// +default="latest"
+	benchstatVersion string,
+
+	// Output format of benchstat (text, csv).
+	//
+	// +optional
+	// +default="text"
+	format string,
+) *dagger.File {
+	const outputPath = "/work/benchstat.txt"
+
+	if count == 0 {
+		count = 6
+	}
+
+	if benchstatVersion == "" {
+		benchstatVersion = "latest"
+	}
+
+	if format == "" {
+		format = "text"
+	}
+
+	baseOutput := m.WithSource(base).Bench(packages, bench, count, benchtime, benchmem)
+
+	// mounting the baseline results makes sure the benchmarks do not run in parallel
+	headOutput := m.WithSource(head).
+		Container().
+		WithMountedFile("/work/base.txt", baseOutput).
+		WithExec(benchArgs(packages, bench, count, benchtime, benchmem), dagger.ContainerWithExecOpts{
+			RedirectStdout: benchOutputPath,
+		}).
+		File(benchOutputPath)
+
+	benchstat := m.install("golang.org/x/perf/cmd/benchstat", benchstatVersion)
+
+	return m.Container.
+		WithFile("/usr/local/bin/benchstat", benchstat).
+		WithMountedFile("/work/base.txt", baseOutput).
+		WithMountedFile("/work/head.txt", headOutput).
+		WithWorkdir("/work").
+		WithExec(
+			[]string{"benchstat", "-format", format, "base=base.txt", "head=head.txt"},
+			dagger.ContainerWithExecOpts{RedirectStdout: outputPath},
+		).
+		File(outputPath)
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"dagger/go/internal/dagger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Findings reported by a check.
+type Report struct {
+	Findings []Finding
+}
+
+// A problem reported by a check.
+type Finding struct {
+	// Code of the finding (e.g., the name of the vet analyzer or the ID of the vulnerability).
+	Code string
+
+	// Import path of the package the finding belongs to.
+	Package string
+
+	// Position of the finding in the source (file:line:column).
+	Position string
+
+	// Description of the finding.
+	Message string
+}
+
+func (f Finding) format() string {
+	if f.Position == "" {
+		return fmt.Sprintf("%s: %s (%s)", f.Package, f.Message, f.Code)
+	}
+
+	return fmt.Sprintf("%s: %s (%s)", f.Position, f.Message, f.Code)
+}
+
+// Return an error if there are any findings.
+func (r *Report) Check() error {
+	if len(r.Findings) == 0 {
+		return nil
+	}
+
+	lines := make([]string, 0, len(r.Findings))
+	for _, finding := range r.Findings {
+		lines = append(lines, finding.format())
+	}
+
+	return fmt.Errorf("%d finding(s):\n%s", len(r.Findings), strings.Join(lines, "\n"))
+}
+
+// Run "go vet" and collect the reported problems.
+//
+// Consult "go help vet" for more information.
+func (m *WithSource) Vet(
+	ctx context.Context,
+
+	// Packages to vet.
+	//
+	// +optional
+	// +default=["./..."]
+	packages []string,
+
+	// A list of additional build tags to consider satisfied during the build.
+	//
+	// +optional
+	tags []string,
+) (*Report, error) {
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+
+	args := []string{"go", "vet", "-json"}
+
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+
+	args = append(args, packages...)
+
+	container := m.Container().WithExec(args, dagger.ContainerWithExecOpts{
+		Expect: dagger.ReturnTypeAny,
+	})
+
+	exitCode, err := container.ExitCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Depending on the Go version, diagnostics are written either to stdout or stderr
+	stdout, err := container.Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stderr, err := container.Stderr(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// vet exits with zero in JSON mode, unless it fails to analyze the packages
+	if exitCode != 0 {
+		return nil, fmt.Errorf("go vet exited with code %d:\n%s%s", exitCode, stdout, stderr)
+	}
+
+	findings, err := parseVetOutput(stdout + "\n" + stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Report{
+		Findings: findings,
+	}, nil
+}
+
+// parseVetOutput parses the output of "go vet -json": a JSON object per package, interleaved with "# package" comments.
+func parseVetOutput(output string) ([]Finding, error) {
+	var lines []string
+
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(strings.Join(lines, "\n")))
+
+	var findings []Finding
+
+	for {
+		var result map[string]map[string]json.RawMessage
+
+		err := decoder.Decode(&result)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parsing vet output: %w", err)
+		}
+
+		for pkg, analyzers := range result {
+			for analyzer, raw := range analyzers {
+				var diagnostics []struct {
+					Posn    string `json:"posn"`
+					Message string `json:"message"`
+				}
+
+				// analyzers report an object with an error field if they fail
+				if err := json.Unmarshal(raw, &diagnostics); err != nil {
+					var failure struct {
+						Error string `json:"error"`
+					}
+
+					if err := json.Unmarshal(raw, &failure); err != nil {
+						return nil, fmt.Errorf("parsing vet output: %w", err)
+					}
+
+					return nil, fmt.Errorf("%s: analyzer %s failed: %s", pkg, analyzer, failure.Error)
+				}
+
+				for _, diagnostic := range diagnostics {
+					findings = append(findings, Finding{
+						Code:     analyzer,
+						Package:  pkg,
+						Position: strings.TrimPrefix(diagnostic.Posn, workdir+"/"),
+						Message:  diagnostic.Message,
+					})
+				}
+			}
+		}
+	}
+
+	sortFindings(findings)
+
+	return findings, nil
+}
+
+func sortFindings(findings []Finding) {
+	slices.SortFunc(findings, func(a, b Finding) int {
+		if c := strings.Compare(a.Package, b.Package); c != 0 {
+			return c
+		}
+
+		if c := strings.Compare(a.Position, b.Position); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Code, b.Code)
+	})
+}
+
+// Run govulncheck and collect the vulnerabilities affecting the code.
+//
+// Only vulnerabilities in functions actually called by the code are reported.
+func (m *WithSource) Vulncheck(
+	ctx context.Context,
+
+	// Packages to check.
+	//
+	// +optional
+	// +default=["./..."]
+	packages []string,
+
+	// Version of govulncheck to use.
+	//
+	// +optional
+	// +default="latest"
+	version string,
+
+	// Vulnerability database (in the format served by vuln.go.dev) to use instead of the default one (e.g., for offline use).
+	//
+	// +optional
+	db *dagger.Directory,
+
+	// A list of additional build tags to consider satisfied during the build.
+	//
+	// +optional
+	tags []string,
+) (*Report, error) {
+	const dbPath = "/work/vulndb"
+
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+
+	if version == "" {
+		version = "latest"
+	}
+
+	args := []string{"govulncheck", "-format", "json"}
+
+	if db != nil {
+		args = append(args, "-db", "file://"+dbPath)
+	}
+
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+
+	args = append(args, packages...)
+
+	govulncheck := m.Go.install("golang.org/x/vuln/cmd/govulncheck", version)
+
+	output, err := m.Container().
+		WithFile("/usr/local/bin/govulncheck", govulncheck).
+		With(func(c *dagger.Container) *dagger.Container {
+			if db != nil {
+				c = c.WithMountedDirectory(dbPath, db)
+			} else {
+				c = c.WithEnvVariable("CACHE_BUSTER", time.Now().Format(time.RFC3339Nano)) // The default database is fetched on every run
+			}
+
+			return c
+		}).
+		WithExec(args).
+		Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	findings, err := parseVulncheckOutput(output)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Report{
+		Findings: findings,
+	}, nil
+}
+
+// parseVulncheckOutput parses the output of "govulncheck -format json": a stream of JSON messages.
+func parseVulncheckOutput(output string) ([]Finding, error) {
+	type frame struct {
+		Module   string `json:"module"`
+		Version  string `json:"version"`
+		Package  string `json:"package"`
+		Function string `json:"function"`
+		Receiver string `json:"receiver"`
+		Position *struct {
+			Filename string `json:"filename"`
+			Line     int    `json:"line"`
+			Column   int    `json:"column"`
+		} `json:"position"`
+	}
+
+	type message struct {
+		OSV *struct {
+			ID      string `json:"id"`
+			Summary string `json:"summary"`
+		} `json:"osv"`
+
+		Finding *struct {
+			OSV          string  `json:"osv"`
+			FixedVersion string  `json:"fixed_version"`
+			Trace        []frame `json:"trace"`
+		} `json:"finding"`
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(output))
+
+	summaries := map[string]string{}
+	findings := map[string]Finding{}
+
+	for {
+		var msg message
+
+		err := decoder.Decode(&msg)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parsing govulncheck output: %w", err)
+		}
+
+		if msg.OSV != nil {
+			summaries[msg.OSV.ID] = msg.OSV.Summary
+		}
+
+		// findings without a function in the first frame are only imported, not called
+		if msg.Finding == nil || len(msg.Finding.Trace) == 0 || msg.Finding.Trace[0].Function == "" {
+			continue
+		}
+
+		if _, ok := findings[msg.Finding.OSV]; ok {
+			continue
+		}
+
+		vulnerable := msg.Finding.Trace[0]
+
+		// the last frame is the entry point in the code
+		entry := msg.Finding.Trace[len(msg.Finding.Trace)-1]
+
+		var position string
+		if entry.Position != nil {
+			position = fmt.Sprintf("%s:%d:%d", strings.TrimPrefix(entry.Position.Filename, workdir+"/"), entry.Position.Line, entry.Position.Column)
+		}
+
+		fixed := "no fixed version available"
+		if msg.Finding.FixedVersion != "" {
+			fixed = "fixed in " + msg.Finding.FixedVersion
+		}
+
+		findings[msg.Finding.OSV] = Finding{
+			Code:     msg.Finding.OSV,
+			Package:  vulnerable.Package,
+			Position: position,
+			Message:  fmt.Sprintf("%s@%s (%s)", vulnerable.Module, vulnerable.Version, fixed),
+		}
+	}
+
+	result := make([]Finding, 0, len(findings))
+
+	for id, finding := range findings {
+		if summary := summaries[id]; summary != "" {
+			finding.Message = summary + ": " + finding.Message
+		}
+
+		result = append(result, finding)
+	}
+
+	sortFindings(result)
+
+	return result, nil
+}
+
+// Check that "go mod tidy" does not modify go.mod and go.sum.
+//
+// Every file "go mod tidy" would add, modify or remove is reported as a finding.
+func (m *WithSource) ModTidyCheck(ctx context.Context) (*Report, error) {
+	changes := m.Container().
+		WithExec([]string{"go", "mod", "tidy"}).
+		Directory(workdir).
+		Changes(m.Source)
+
+	added, err := changes.AddedPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	modified, err := changes.ModifiedPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := changes.RemovedPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+
+	for _, change := range []struct {
+		paths   []string
+		message string
+	}{
+		{added, "go mod tidy would add this file"},
+		{modified, "go mod tidy would modify this file"},
+		{removed, "go mod tidy would remove this file"},
+	} {
+		for _, p := range change.paths {
+			findings = append(findings, Finding{
+				Code:     "mod-tidy",
+				Position: p,
+				Message:  change.message,
+			})
+		}
+	}
+
+	sortFindings(findings)
+
+	return &Report{
+		Findings: findings,
+	}, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"dagger/go/internal/dagger"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type Codegen struct {
+	// +private
+	WithSource *WithSource
+
+	// +private
+	Packages []string
+
+	// +private
+	RunPattern string
+
+	// +private
+	SkipPattern string
+}
+
+func (m *Codegen) args() []string {
+	args := []string{"go", "generate"}
+
+	if m.RunPattern != "" {
+		args = append(args, "-run", m.RunPattern)
+	}
+
+	if m.SkipPattern != "" {
+		args = append(args, "-skip", m.SkipPattern)
+	}
+
+	if len(m.Packages) > 0 {
+		args = append(args, m.Packages...)
+	}
+
+	return args
+}
+
+// Generate code.
+func (m *Codegen) Run() *dagger.Changeset {
+	return m.WithSource.Container().
+		WithExec(m.args()).
+		Directory(workdir).
+		Changes(m.WithSource.Source)
+}
+
+// Run in check mode: fail if generated files are out of date.
+func (m *Codegen) Check(ctx context.Context) error {
+	return checkChanges(ctx, m.Run(), "generated files are out of date")
+}
+
+type Fmt struct {
+	// +private
+	WithSource *WithSource
+
+	// +private
+	Simplify bool
+
+	// +private
+	Goimports bool
+
+	// +private
+	GoimportsVersion string
+
+	// +private
+	Local []string
+}
+
+// Format Go source files using gofmt (or goimports).
+//
+// Vendored dependencies and testdata directories are skipped.
+func (m *WithSource) Fmt(
+	// Try to simplify code (gofmt -s).
+	//
+	// +optional
+	simplify bool,
+
+	// Use goimports instead of gofmt (also updates import lines).
+	//
+	// +optional
+	goimports bool,
+
+	// Version of goimports to use.
+	//
+	// +optional
+	// +default="latest"
+	goimportsVersion string,
+
+	// Put imports beginning with these prefixes after 3rd-party packages (goimports -local).
+	//
+	// +optional
+	local []string,
+) *Fmt {
+	if goimportsVersion == "" {
+		goimportsVersion = "latest"
+	}
+
+	return &Fmt{
+		WithSource:       m,
+		Simplify:         simplify,
+		Goimports:        goimports,
+		GoimportsVersion: goimportsVersion,
+		Local:            local,
+	}
+}
+
+func (m *Fmt) container() *dagger.Container {
+	args := []string{"gofmt", "-l", "-w"}
+
+	if m.Simplify {
+		args = append(args, "-s")
+	}
+
+	container := m.WithSource.Container()
+
+	if m.Goimports {
+		args = []string{"goimports", "-l", "-w"}
+
+		if len(m.Local) > 0 {
+			args = append(args, "-local", strings.Join(m.Local, ","))
+		}
+
+		container = container.WithFile(
+			"/usr/local/bin/goimports",
+			m.WithSource.Go.install("golang.org/x/tools/cmd/goimports", m.GoimportsVersion),
+		)
+	}
+
+	script := fmt.Sprintf(
+		`find . -name '*.go' -not -path '*/vendor/*' -not -path '*/testdata/*' -not -path './.git/*' -print0 | xargs -0 -r %s`,
+		strings.Join(args, " "),
+	)
+
+	return container.WithExec([]string{"sh", "-c", script})
+}
+
+// Format code.
+func (m *Fmt) Run() *dagger.Changeset {
+	return m.container().Directory(workdir).Changes(m.WithSource.Source)
+}
+
+// Run in check mode: fail if files are not formatted.
+func (m *Fmt) Check(ctx context.Context) error {
+	return checkChanges(ctx, m.Run(), "files are not formatted")
+}
+
+// changedPaths returns the paths added, modified or removed by a changeset.
+func changedPaths(ctx context.Context, changes *dagger.Changeset) ([]string, error) {
+	added, err := changes.AddedPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	modified, err := changes.ModifiedPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := changes.RemovedPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := slices.Concat(added, modified, removed)
+	slices.Sort(paths)
+
+	return paths, nil
+}
+
+// checkChanges returns an error listing the changed files if the changeset is not empty.
+func checkChanges(ctx context.Context, changes *dagger.Changeset, message string) error {
+	paths, err := changedPaths(ctx, changes)
+	if err != nil {
+		return err
+	}
+
+	if len(paths) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%s:\n%s", message, strings.Join(paths, "\n"))
+}
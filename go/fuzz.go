@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"dagger/go/internal/dagger"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// Run a fuzz test.
+//
+// The fuzz cache (containing the generated corpus) is persisted in a cache volume between runs.
+// Failing inputs are written to testdata/fuzz in the package directory (just like "go test -fuzz" does)
+// and can be exported from the result to be committed as regression tests.
+//
+// Fuzz failures do not cause the function to fail: consult the returned result (or call Check on it) instead.
+func (m *WithSource) Fuzz(
+	ctx context.Context,
+
+	// Name of the fuzz test to run (e.g., "FuzzParse").
+	target string,
+
+	// Package containing the fuzz test.
+	//
+	// +optional
+	// +default="."
+	pkg string,
+
+	// Time (e.g., "30s") or number of iterations (e.g., "1000x") to spend fuzzing.
+	//
+	// +optional
+	// +default="10s"
+	fuzztime string,
+
+	// Cache volume to persist the fuzz cache in.
+	//
+	// +optional
+	cache *dagger.CacheVolume,
+
+	// A list of additional build tags to consider satisfied during the build.
+	//
+	// +optional
+	tags []string,
+) (*FuzzResult, error) {
+	// the fuzz cache is stored in the build cache by default
+	const cachePath = "/root/.cache/go-build/fuzz"
+
+	if target == "" {
+		return nil, errors.New("fuzz target is required")
+	}
+
+	if pkg == "" {
+		pkg = "."
+	}
+
+	if fuzztime == "" {
+		fuzztime = "10s"
+	}
+
+	if cache == nil {
+		cache = dag.CacheVolume("go-fuzz")
+	}
+
+	args := []string{"go", "test", "-run", "^$", "-fuzz", "^" + target + "$", "-fuzztime", fuzztime}
+
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+
+	args = append(args, pkg)
+
+	container := m.Container().
+		WithMountedCache(cachePath, cache).
+		WithEnvVariable("CACHE_BUSTER", time.Now().Format(time.RFC3339Nano)). // Keep growing the corpus on every run
+		WithExec(args, dagger.ContainerWithExecOpts{
+			Expect: dagger.ReturnTypeAny,
+		})
+
+	exitCode, err := container.ExitCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := container.Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stderr, err := container.Stderr(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := container.Directory(workdir).Changes(m.Source)
+
+	added, err := changes.AddedPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []FuzzInput
+
+	for _, p := range added {
+		// inputs are stored as testdata/fuzz/{target}/{hash}
+		_, input, ok := strings.Cut(p, "testdata/fuzz/")
+		if !ok || strings.Count(input, "/") != 1 || strings.HasSuffix(input, "/") {
+			continue
+		}
+
+		contents, err := changes.After().File(p).Contents(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, FuzzInput{
+			Path:     p,
+			Contents: contents,
+		})
+	}
+
+	return &FuzzResult{
+		Passed:  exitCode == 0,
+		Output:  stdout + stderr,
+		Inputs:  inputs,
+		Changes: changes,
+	}, nil
+}
+
+// Result of a fuzz test.
+type FuzzResult struct {
+	// Whether fuzzing found no failures.
+	Passed bool
+
+	// Output of the fuzz test.
+	Output string
+
+	// Newly discovered failing inputs.
+	Inputs []FuzzInput
+
+	// Newly discovered failing inputs (under testdata/fuzz) as changes to the source directory.
+	Changes *dagger.Changeset
+}
+
+// A failing input discovered by fuzzing.
+type FuzzInput struct {
+	// Path of the input file (relative to the source directory).
+	Path string
+
+	// Contents of the input file (in the "go test fuzz v1" encoding).
+	Contents string
+}
+
+// Return an error (containing the crash reproducer) if fuzzing found a failure.
+func (r *FuzzResult) Check() error {
+	if r.Passed {
+		return nil
+	}
+
+	var b strings.Builder
+
+	b.WriteString("fuzzing found a failure:\n")
+	b.WriteString(r.Output)
+
+	for _, input := range r.Inputs {
+		fmt.Fprintf(&b, "\nreproducer (%s):\n%s", input.Path, input.Contents)
+		fmt.Fprintf(&b, "\nrerun with: go test -run %s/%s\n", path.Base(path.Dir(input.Path)), path.Base(input.Path))
+	}
+
+	return errors.New(b.String())
+}
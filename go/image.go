@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"dagger/go/internal/dagger"
+	"fmt"
+	"path"
+	"strings"
+
+	cplatforms "github.com/containerd/platforms"
+)
+
+// Minimal Wolfi based image (similar to cgr.dev/chainguard/static) used as the default base image.
+const staticBaseConfig = `contents:
+  keyring:
+    - https://packages.wolfi.dev/os/wolfi-signing.rsa.pub
+  repositories:
+    - https://packages.wolfi.dev/os
+  packages:
+    - ca-certificates-bundle
+    - tzdata
+    - wolfi-baselayout
+
+accounts:
+  groups:
+    - groupname: nonroot
+      gid: 65532
+  users:
+    - username: nonroot
+      uid: 65532
+      gid: 65532
+  run-as: "65532"
+`
+
+// Architectures supported by Wolfi.
+var wolfiArchs = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "aarch64",
+}
+
+// Build a container image from a static binary (similar to ko).
+//
+// The binary is built with cgo disabled for each platform and copied to /usr/local/bin on top of the base image.
+// OCI labels (version, revision and creation date) are populated from the version information (see WithVersionInfo and WithGitVersionInfo).
+func (m *WithSource) Image(
+	ctx context.Context,
+
+	// Package to compile.
+	//
+	// +optional
+	pkg string,
+
+	// Base image reference (defaults to a minimal Wolfi image built with apko).
+	//
+	// +optional
+	base string,
+
+	// Target platforms (defaults to the platform of the engine).
+	//
+	// +optional
+	platforms []dagger.Platform,
+
+	// Default arguments passed to the binary.
+	//
+	// +optional
+	entrypointArgs []string,
+
+	// Additional labels in key=value format (take precedence over labels populated from version information).
+	//
+	// +optional
+	labels []string,
+
+	// Arguments to pass on each go tool link invocation.
+	//
+	// Once version information is set (see WithVersionInfo), arguments are rendered as templates (e.g., "-X main.version={{.Version}}").
+	//
+	// +optional
+	ldflags []string,
+
+	// Name of the binary (defaults to the last element of the package or module path).
+	//
+	// +optional
+	name string,
+) ([]*dagger.Container, error) {
+	if len(platforms) == 0 {
+		platform, err := dag.DefaultPlatform(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		platforms = []dagger.Platform{platform}
+	}
+
+	if name == "" {
+		var err error
+
+		name, err = m.binaryName(ctx, pkg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	imageLabels := [][2]string{}
+
+	if v := m.Go.VersionInfo.Version; v != "" {
+		imageLabels = append(imageLabels, [2]string{"org.opencontainers.image.version", v})
+	}
+
+	if v := m.Go.VersionInfo.Commit; v != "" {
+		imageLabels = append(imageLabels, [2]string{"org.opencontainers.image.revision", v})
+	}
+
+	if v := m.Go.VersionInfo.Date; v != "" {
+		imageLabels = append(imageLabels, [2]string{"org.opencontainers.image.created", v})
+	}
+
+	for _, label := range labels {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q: expected key=value format", label)
+		}
+
+		imageLabels = append(imageLabels, [2]string{key, value})
+	}
+
+	var baseImage *dagger.File
+
+	if base == "" {
+		config := dag.Apko().Config(dag.Directory().WithNewFile("static.yaml", staticBaseConfig).File("static.yaml"))
+
+		for _, platform := range platforms {
+			p, err := cplatforms.Parse(string(platform))
+			if err != nil {
+				return nil, fmt.Errorf("parsing platform %q: %w", platform, err)
+			}
+
+			arch, ok := wolfiArchs[p.Architecture]
+			if p.OS != "linux" || !ok {
+				return nil, fmt.Errorf("platform %q is not supported by the default base image: specify a base image", platform)
+			}
+
+			config = config.WithArch(arch)
+		}
+
+		baseImage = config.Build("latest").File()
+	}
+
+	binaryPath := path.Join("/usr/local/bin", name)
+
+	containers := make([]*dagger.Container, 0, len(platforms))
+
+	for _, platform := range platforms {
+		binary, err := m.clone().WithCgoDisabled().Build(pkg, false, ldflags, nil, true, nil, platform)
+		if err != nil {
+			return nil, err
+		}
+
+		container := dag.Container(dagger.ContainerOpts{Platform: platform})
+
+		if baseImage != nil {
+			container = container.Import(baseImage)
+		} else {
+			container = container.From(base)
+		}
+
+		container = container.
+			WithFile(binaryPath, binary, dagger.ContainerWithFileOpts{Permissions: 0755}).
+			WithEntrypoint([]string{binaryPath}).
+			WithDefaultArgs(entrypointArgs)
+
+		for _, label := range imageLabels {
+			container = container.WithLabel(label[0], label[1])
+		}
+
+		containers = append(containers, container)
+	}
+
+	return containers, nil
+}
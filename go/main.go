@@ -2,8 +2,10 @@
 package main
 
 import (
+	"context"
 	"dagger/go/internal/dagger"
 	"fmt"
+	"path"
 	"strings"
 
 	"github.com/containerd/platforms"
@@ -16,14 +18,35 @@ const workdir = "/work/src"
 
 type Go struct {
 	Container *dagger.Container
+
+	// +private
+	VersionInfo VersionInfo
+
+	// +private
+	LdflagsTemplates bool
+
+	// +private
+	PrivateModules []string
+
+	// +private
+	GitCredentials []GitCredential
 }
 
 func New(
+	ctx context.Context,
+
 	// Version (image tag) to use from the official image repository as a base container.
 	//
 	// +optional
 	version string,
 
+	// Source directory to detect the version from (using the toolchain or go directive in go.work or go.mod).
+	//
+	// Ignored if a version or a custom container is specified.
+	//
+	// +optional
+	source *dagger.Directory,
+
 	// Custom container to use as a base container.
 	//
 	// +optional
@@ -33,8 +56,17 @@ func New(
 	//
 	// +optional
 	disableCache bool,
-) *Go {
+) (*Go, error) {
 	if container == nil {
+		if version == "" && source != nil {
+			var err error
+
+			version, err = detectVersion(ctx, source)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		if version == "" {
 			version = "latest"
 		}
@@ -52,7 +84,7 @@ func New(
 			WithBuildCache(dag.CacheVolume("go-build"), nil, "")
 	}
 
-	return m
+	return m, nil
 }
 
 // Set an environment variable.
@@ -184,6 +216,20 @@ func (m *Go) WithBuildCache(
 	return m
 }
 
+// install builds a Go program (using "go install") and returns the binary.
+func (m *Go) install(pkg string, version string) *dagger.File {
+	const gobin = "/work/bin"
+
+	// make sure the binary is built for the platform it runs on
+	return m.Container.
+		WithoutEnvVariable("GOOS").
+		WithoutEnvVariable("GOARCH").
+		WithoutEnvVariable("GOARM").
+		WithEnvVariable("GOBIN", gobin).
+		WithExec([]string{"go", "install", pkg + "@" + version}).
+		File(path.Join(gobin, path.Base(pkg)))
+}
+
 // Run a Go command.
 func (m *Go) Exec(
 	// Arguments to pass to the Go command.
@@ -241,6 +287,37 @@ func (m *Go) Generate(
 	).Source
 }
 
+// Run "go generate" command and return the changes it makes (or check that generated files are up to date).
+//
+// Consult "go help generate" for more information.
+func (m *Go) Codegen(
+	// Source directory to mount.
+	source *dagger.Directory,
+
+	// Packages (or files) to run "go generate" on.
+	//
+	// +optional
+	packages []string,
+
+	// A regular expression to select directives whose full original source text (excluding any trailing spaces and final newline) matches the expression.
+	//
+	// +optional
+	run string,
+
+	// A regular expression to suppress directives whose full original source text (excluding any trailing spaces and final newline) matches the expression.
+	//
+	// +optional
+	skip string,
+
+	// TODO: add -v, -n and -x flags
+) *Codegen {
+	return m.WithSource(source).Codegen(
+		packages,
+		run,
+		skip,
+	)
+}
+
 // Build a binary.
 func (m *Go) Build(
 	// Source directory to mount.
@@ -258,6 +335,8 @@ func (m *Go) Build(
 
 	// Arguments to pass on each go tool link invocation.
 	//
+	// Once version information is set (see WithVersionInfo), arguments are rendered as templates (e.g., "-X main.version={{.Version}}").
+	//
 	// +optional
 	ldflags []string,
 
@@ -280,7 +359,7 @@ func (m *Go) Build(
 	//
 	// +optional
 	platform dagger.Platform,
-) *dagger.File {
+) (*dagger.File, error) {
 	return m.WithSource(source).Build(
 		pkg,
 		race,
@@ -308,11 +387,16 @@ type WithSource struct {
 
 	// +private
 	Go *Go
+
+	// Directory of the module (relative to the source directory) commands run in.
+	//
+	// +private
+	Dir string
 }
 
 func (m *WithSource) Container() *dagger.Container {
 	return m.Go.Container.
-		WithWorkdir(workdir).
+		WithWorkdir(path.Join(workdir, m.Dir)).
 		WithMountedDirectory(workdir, m.Source)
 }
 
@@ -460,21 +544,36 @@ func (m *WithSource) Generate(
 
 	// TODO: add -v, -n and -x flags
 ) *WithSource {
-	args := []string{"go", "generate"}
+	return m.WithExec(m.Codegen(packages, run, skip).args())
+}
 
-	if run != "" {
-		args = append(args, "-run", run)
-	}
+// Run "go generate" command and return the changes it makes (or check that generated files are up to date).
+//
+// Consult "go help generate" for more information.
+func (m *WithSource) Codegen(
+	// Packages (or files) to run "go generate" on.
+	//
+	// +optional
+	packages []string,
 
-	if skip != "" {
-		args = append(args, "-skip", skip)
-	}
+	// A regular expression to select directives whose full original source text (excluding any trailing spaces and final newline) matches the expression.
+	//
+	// +optional
+	run string,
 
-	if len(packages) > 0 {
-		args = append(args, packages...)
-	}
+	// A regular expression to suppress directives whose full original source text (excluding any trailing spaces and final newline) matches the expression.
+	//
+	// +optional
+	skip string,
 
-	return m.WithExec(args)
+	// TODO: add -v, -n and -x flags
+) *Codegen {
+	return &Codegen{
+		WithSource:  m,
+		Packages:    packages,
+		RunPattern:  run,
+		SkipPattern: skip,
+	}
 }
 
 // Compile the packages into a binary.
@@ -491,6 +590,8 @@ func (m *WithSource) Build(
 
 	// Arguments to pass on each go tool link invocation.
 	//
+	// Once version information is set (see WithVersionInfo), arguments are rendered as templates (e.g., "-X main.version={{.Version}}").
+	//
 	// +optional
 	ldflags []string,
 
@@ -513,7 +614,7 @@ func (m *WithSource) Build(
 	//
 	// +optional
 	platform dagger.Platform,
-) *dagger.File {
+) (*dagger.File, error) {
 	const binaryPath = "/work/out/binary"
 
 	args := []string{"go", "build", "-o", binaryPath}
@@ -522,6 +623,11 @@ func (m *WithSource) Build(
 		args = append(args, "-race")
 	}
 
+	ldflags, err := m.Go.renderLdflags(ldflags)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(ldflags) > 0 {
 		args = append(args, "-ldflags", strings.Join(ldflags, " "))
 	}
@@ -542,5 +648,5 @@ func (m *WithSource) Build(
 		args = append(args, pkg)
 	}
 
-	return m.Exec(args, platform).File(binaryPath)
+	return m.Exec(args, platform).File(binaryPath), nil
 }
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"dagger/go/internal/dagger"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+
+	cplatforms "github.com/containerd/platforms"
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultNameTemplate = "{{.Name}}_{{.OS}}_{{.Arch}}{{if .Variant}}_{{.Variant}}{{end}}"
+
+// Build binaries for multiple platforms in parallel.
+//
+// The resulting directory contains a binary (or an archive, if an archive format is specified) for each platform
+// named after the name template (e.g., "app_linux_amd64", "app_windows_amd64.exe").
+func (m *WithSource) BuildMatrix(
+	ctx context.Context,
+
+	// Package to compile.
+	//
+	// +optional
+	pkg string,
+
+	// Target platforms in "[os]/[platform]/[version]" format (e.g., "darwin/arm64/v7", "windows/amd64", "linux/arm64").
+	platforms []dagger.Platform,
+
+	// Template for the name of the binaries (without extension).
+	//
+	// Available fields: {{.Name}}, {{.OS}}, {{.Arch}} and {{.Variant}}.
+	//
+	// +optional
+	// +default="{{.Name}}_{{.OS}}_{{.Arch}}{{if .Variant}}_{{.Variant}}{{end}}"
+	nameTemplate string,
+
+	// Name of the binary (defaults to the last element of the package or module path).
+	//
+	// +optional
+	name string,
+
+	// Arguments to pass on each go tool link invocation.
+	//
+	// Once version information is set (see WithVersionInfo), arguments are rendered as templates (e.g., "-X main.version={{.Version}}").
+	//
+	// +optional
+	ldflags []string,
+
+	// A list of additional build tags to consider satisfied during the build.
+	//
+	// +optional
+	tags []string,
+
+	// Remove all file system paths from the resulting executable.
+	//
+	// +optional
+	trimpath bool,
+
+	// Archive each binary using one of the formats supported by the arc module (e.g., "tar.gz", "zip").
+	//
+	// +optional
+	archive string,
+
+	// Calculate SHA-256 checksums of the resulting files (written to checksums.txt).
+	//
+	// +optional
+	checksum bool,
+) (*dagger.Directory, error) {
+	if len(platforms) == 0 {
+		return nil, errors.New("at least one platform is required")
+	}
+
+	if nameTemplate == "" {
+		nameTemplate = defaultNameTemplate
+	}
+
+	tpl, err := template.New("name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("parsing name template: %w", err)
+	}
+
+	if name == "" {
+		name, err = m.binaryName(ctx, pkg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files := make([]*dagger.File, len(platforms))
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	for i, platform := range platforms {
+		p, err := cplatforms.Parse(string(platform))
+		if err != nil {
+			return nil, fmt.Errorf("parsing platform %q: %w", platform, err)
+		}
+
+		var buf bytes.Buffer
+
+		err = tpl.Execute(&buf, struct {
+			Name    string
+			OS      string
+			Arch    string
+			Variant string
+		}{
+			Name:    name,
+			OS:      p.OS,
+			Arch:    p.Architecture,
+			Variant: p.Variant,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("executing name template: %w", err)
+		}
+
+		fileName := buf.String()
+		binaryName := name
+
+		if p.OS == "windows" {
+			fileName += ".exe"
+			binaryName += ".exe"
+		}
+
+		binary, err := m.clone().Build(pkg, false, ldflags, tags, trimpath, nil, platform)
+		if err != nil {
+			return nil, err
+		}
+
+		var file *dagger.File
+
+		if archive != "" {
+			file = dag.Arc().
+				ArchiveFiles(strings.TrimSuffix(fileName, ".exe"), []*dagger.File{binary.WithName(binaryName)}).
+				Create(archive)
+		} else {
+			file = binary.WithName(fileName)
+		}
+
+		files[i] = file
+
+		g.Go(func() error {
+			_, err := file.Sync(ctx)
+
+			return err
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	dir := dag.Directory().WithFiles("", files)
+
+	if checksum {
+		dir = dir.WithFile("checksums.txt", dag.Checksum().Sha256().Calculate(files))
+	}
+
+	return dir, nil
+}
+
+// clone returns a copy of the source that can be modified without affecting the original.
+func (m *WithSource) clone() *WithSource {
+	g := *m.Go
+
+	return &WithSource{
+		Source: m.Source,
+		Go:     &g,
+		Dir:    m.Dir,
+	}
+}
+
+var majorVersionSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
+// binaryName returns the default name of the binary built from a package (similar to "go build").
+func (m *WithSource) binaryName(ctx context.Context, pkg string) (string, error) {
+	// "", "." and "./" all refer to the package at the root of the module
+	pkg = path.Clean(pkg)
+
+	if pkg == "." {
+		goMod, err := m.Source.File(path.Join(m.Dir, "go.mod")).Contents(ctx)
+		if err != nil {
+			return "", fmt.Errorf("reading go.mod: %w", err)
+		}
+
+		pkg = modulePath(goMod)
+		if pkg == "" {
+			return "", errors.New("module path not found in go.mod")
+		}
+	}
+
+	if strings.Contains(pkg, "...") {
+		return "", fmt.Errorf("cannot build multiple packages: %s", pkg)
+	}
+
+	name := path.Base(pkg)
+
+	if majorVersionSuffix.MatchString(name) && path.Dir(pkg) != "." {
+		name = path.Base(path.Dir(pkg))
+	}
+
+	return name, nil
+}
+
+// modulePath parses the module path from the contents of a go.mod file.
+func modulePath(goMod string) string {
+	for _, line := range strings.Split(goMod, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"dagger/go/internal/dagger"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	netrcPath        = "/root/.netrc"
+	sshAuthSockPath  = "/run/ssh-agent.sock"
+	sshGitCommandEnv = "ssh -o StrictHostKeyChecking=accept-new"
+)
+
+// Credentials for a host serving Go modules (either a VCS host or a module proxy).
+type GitCredential struct {
+	Host     string
+	Username string
+	Token    *dagger.Secret
+}
+
+// Mark modules as private: they are not verified against the checksum database (GOPRIVATE, GONOSUMDB).
+//
+// By default, private modules are fetched directly from their VCS host.
+func (m *Go) WithPrivateModules(
+	// Glob patterns of module path prefixes (e.g., "github.com/my-org/*").
+	patterns []string,
+
+	// Fetch private modules through the configured module proxy instead of directly from the VCS host (sets GONOPROXY to "none").
+	//
+	// +optional
+	viaProxy bool,
+) *Go {
+	for _, pattern := range patterns {
+		if !slices.Contains(m.PrivateModules, pattern) {
+			m.PrivateModules = append(m.PrivateModules, pattern)
+		}
+	}
+
+	private := strings.Join(m.PrivateModules, ",")
+
+	m.Container = m.Container.
+		WithEnvVariable("GOPRIVATE", private).
+		WithEnvVariable("GONOSUMDB", private)
+
+	if viaProxy {
+		m.Container = m.Container.WithEnvVariable("GONOPROXY", "none")
+	}
+
+	return m
+}
+
+// Set the module proxy (GOPROXY) to download modules from.
+func (m *Go) WithGoproxy(
+	// Proxy URL(s) in GOPROXY format (e.g., "https://proxy.example.com,direct").
+	url string,
+) *Go {
+	m.Container = m.Container.WithEnvVariable("GOPROXY", url)
+
+	return m
+}
+
+// Add credentials for a VCS host (e.g., github.com) or a module proxy.
+//
+// Credentials are written to a .netrc file (used by both the go command and git) mounted as a secret.
+// The go command only sends them over HTTPS, to hosts matching exactly (including the port, if any).
+func (m *Go) WithGitCredentials(
+	ctx context.Context,
+
+	// Host name (e.g., "github.com").
+	host string,
+
+	// Username (some hosts accept any non-empty value when authenticating with a token).
+	username string,
+
+	// Password or access token.
+	token *dagger.Secret,
+) (*Go, error) {
+	m.GitCredentials = slices.DeleteFunc(m.GitCredentials, func(c GitCredential) bool {
+		return c.Host == host
+	})
+
+	m.GitCredentials = append(m.GitCredentials, GitCredential{
+		Host:     host,
+		Username: username,
+		Token:    token,
+	})
+
+	var netrc strings.Builder
+
+	for _, credential := range m.GitCredentials {
+		plaintext, err := credential.Token.Plaintext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(&netrc, "machine %s\nlogin %s\npassword %s\n", credential.Host, credential.Username, plaintext)
+	}
+
+	h := sha1.New()
+
+	_, err := h.Write([]byte(netrc.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	secret := dag.SetSecret(fmt.Sprintf("go-netrc-%x", h.Sum(nil)), netrc.String())
+
+	m.Container = m.Container.WithMountedSecret(netrcPath, secret, dagger.ContainerWithMountedSecretOpts{
+		Mode: 0600,
+	})
+
+	return m, nil
+}
+
+// Use an SSH agent socket to authenticate to VCS hosts.
+//
+// HTTPS URLs of the listed hosts are rewritten to SSH URLs (git@host), so that modules are fetched over SSH.
+func (m *Go) WithSSHAuthSocket(
+	// SSH agent socket.
+	socket *dagger.Socket,
+
+	// Hosts (e.g., "github.com") to fetch modules from over SSH.
+	//
+	// +optional
+	hosts []string,
+) *Go {
+	m.Container = m.Container.
+		WithUnixSocket(sshAuthSockPath, socket).
+		WithEnvVariable("SSH_AUTH_SOCK", sshAuthSockPath).
+		WithEnvVariable("GIT_SSH_COMMAND", sshGitCommandEnv)
+
+	for _, host := range hosts {
+		m.Container = m.Container.WithExec([]string{
+			"git", "config", "--global",
+			fmt.Sprintf("url.ssh://git@%s/.insteadOf", host),
+			fmt.Sprintf("https://%s/", host),
+		})
+	}
+
+	return m
+}
+
+// Mark modules as private: they are not verified against the checksum database (GOPRIVATE, GONOSUMDB).
+//
+// By default, private modules are fetched directly from their VCS host.
+func (m *WithSource) WithPrivateModules(
+	// Glob patterns of module path prefixes (e.g., "github.com/my-org/*").
+	patterns []string,
+
+	// Fetch private modules through the configured module proxy instead of directly from the VCS host (sets GONOPROXY to "none").
+	//
+	// +optional
+	viaProxy bool,
+) *WithSource {
+	m.Go = m.Go.WithPrivateModules(patterns, viaProxy)
+
+	return m
+}
+
+// Set the module proxy (GOPROXY) to download modules from.
+func (m *WithSource) WithGoproxy(
+	// Proxy URL(s) in GOPROXY format (e.g., "https://proxy.example.com,direct").
+	url string,
+) *WithSource {
+	m.Go = m.Go.WithGoproxy(url)
+
+	return m
+}
+
+// Add credentials for a VCS host (e.g., github.com) or a module proxy.
+//
+// Credentials are written to a .netrc file (used by both the go command and git) mounted as a secret.
+// The go command only sends them over HTTPS, to hosts matching exactly (including the port, if any).
+func (m *WithSource) WithGitCredentials(
+	ctx context.Context,
+
+	// Host name (e.g., "github.com").
+	host string,
+
+	// Username (some hosts accept any non-empty value when authenticating with a token).
+	username string,
+
+	// Password or access token.
+	token *dagger.Secret,
+) (*WithSource, error) {
+	g, err := m.Go.WithGitCredentials(ctx, host, username, token)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Go = g
+
+	return m, nil
+}
+
+// Use an SSH agent socket to authenticate to VCS hosts.
+//
+// HTTPS URLs of the listed hosts are rewritten to SSH URLs (git@host), so that modules are fetched over SSH.
+func (m *WithSource) WithSSHAuthSocket(
+	// SSH agent socket.
+	socket *dagger.Socket,
+
+	// Hosts (e.g., "github.com") to fetch modules from over SSH.
+	//
+	// +optional
+	hosts []string,
+) *WithSource {
+	m.Go = m.Go.WithSSHAuthSocket(socket, hosts)
+
+	return m
+}
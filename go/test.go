@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"dagger/go/internal/dagger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Run tests and collect the results.
+//
+// Test failures do not cause the function to fail: consult the returned result (or call Check on it) instead.
+func (m *WithSource) Test(
+	ctx context.Context,
+
+	// Packages to test.
+	//
+	// +optional
+	// +default=["./..."]
+	packages []string,
+
+	// Run only those tests, examples, fuzz tests and benchmarks matching the regular expression.
+	//
+	// +optional
+	run string,
+
+	// Enable data race detection.
+	//
+	// +optional
+	race bool,
+
+	// Run each test, benchmark and fuzz seed n times (1 disables the test cache).
+	//
+	// +optional
+	count int,
+
+	// Tell long-running tests to shorten their run time.
+	//
+	// +optional
+	short bool,
+
+	// If a test binary runs longer than the specified duration, panic (e.g., "10m").
+	//
+	// +optional
+	timeout string,
+
+	// Collect a coverage profile.
+	//
+	// +optional
+	coverprofile bool,
+
+	// A list of additional build tags to consider satisfied during the build.
+	//
+	// +optional
+	tags []string,
+) (*TestResult, error) {
+	const outputPath = "/work/test.json"
+	const coverprofilePath = "/work/coverage.out"
+
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+
+	args := []string{"go", "test", "-json"}
+
+	if run != "" {
+		args = append(args, "-run", run)
+	}
+
+	if race {
+		args = append(args, "-race")
+	}
+
+	if count > 0 {
+		args = append(args, "-count", strconv.Itoa(count))
+	}
+
+	if short {
+		args = append(args, "-short")
+	}
+
+	if timeout != "" {
+		args = append(args, "-timeout", timeout)
+	}
+
+	if coverprofile {
+		args = append(args, "-coverprofile", coverprofilePath)
+	}
+
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+
+	args = append(args, packages...)
+
+	container := m.Container().WithExec(args, dagger.ContainerWithExecOpts{
+		RedirectStdout: outputPath,
+		Expect:         dagger.ReturnTypeAny,
+	})
+
+	exitCode, err := container.ExitCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	output := container.File(outputPath)
+
+	contents, err := output.Contents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := parseTestOutput(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	// go test exits with a non-zero code without reporting a failure in the JSON output if it fails to start (e.g., invalid flags)
+	if exitCode != 0 && result.Passed {
+		stderr, err := container.Stderr(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("go test exited with code %d: %s", exitCode, stderr)
+	}
+
+	result.Output = output
+
+	if coverprofile {
+		// the profile is not written (or left empty) if the packages fail to build
+		exists, err := container.Directory(path.Dir(coverprofilePath)).Exists(ctx, path.Base(coverprofilePath))
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			return result, nil
+		}
+
+		size, err := container.File(coverprofilePath).Size(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if size == 0 {
+			return result, nil
+		}
+
+		result.Coverprofile = container.File(coverprofilePath)
+
+		out, err := container.
+			WithExec([]string{"go", "tool", "cover", "-func", coverprofilePath}).
+			Stdout(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Coverage, err = parseCoverageTotal(out)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Result of a test run.
+type TestResult struct {
+	// Whether every package passed.
+	Passed bool
+
+	// Results of the individual packages.
+	Packages []TestPackage
+
+	// Failed tests (and packages that failed to build or failed outside of a test).
+	Failures []TestFailure
+
+	// Raw output of the test run (in "go test -json" format).
+	Output *dagger.File
+
+	// Coverage profile (if enabled).
+	Coverprofile *dagger.File
+
+	// Total statement coverage percentage (if enabled).
+	Coverage float64
+}
+
+// Result of a package in a test run.
+type TestPackage struct {
+	// Import path of the package.
+	Name string
+
+	// Outcome of the package (pass, fail or skip).
+	Status string
+
+	// Time it took to test the package (in seconds).
+	Elapsed float64
+
+	// Number of passed tests.
+	Passed int
+
+	// Number of failed tests.
+	Failed int
+
+	// Number of skipped tests.
+	Skipped int
+}
+
+// A failed test.
+type TestFailure struct {
+	// Import path of the package.
+	Package string
+
+	// Name of the test (empty if the package failed outside of a test, e.g., due to a build error).
+	Test string
+
+	// Output of the test.
+	Output string
+}
+
+// Return an error if the test run failed.
+func (r *TestResult) Check() error {
+	if r.Passed {
+		return nil
+	}
+
+	var errs []error
+
+	for _, failure := range r.Failures {
+		name := failure.Package
+		if failure.Test != "" {
+			name = fmt.Sprintf("%s.%s", failure.Package, failure.Test)
+		}
+
+		errs = append(errs, fmt.Errorf("--- FAIL: %s\n%s", name, failure.Output))
+	}
+
+	return fmt.Errorf("tests failed:\n%w", errors.Join(errs...))
+}
+
+// testEvent is the JSON format of "go test -json" (see "go doc test2json").
+type testEvent struct {
+	Action      string
+	Package     string
+	ImportPath  string
+	Test        string
+	Elapsed     float64
+	Output      string
+	FailedBuild string
+}
+
+func parseTestOutput(output string) (*TestResult, error) {
+	type testKey struct {
+		pkg  string
+		test string
+	}
+
+	result := &TestResult{
+		Passed: true,
+	}
+
+	packages := map[string]*TestPackage{}
+	outputs := map[testKey]*strings.Builder{}
+	buildOutputs := map[string]*strings.Builder{}
+
+	getPackage := func(name string) *TestPackage {
+		pkg, ok := packages[name]
+		if !ok {
+			pkg = &TestPackage{Name: name}
+			packages[name] = pkg
+		}
+
+		return pkg
+	}
+
+	appendOutput := func(key testKey, output string) {
+		b, ok := outputs[key]
+		if !ok {
+			b = &strings.Builder{}
+			outputs[key] = b
+		}
+
+		b.WriteString(output)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var event testEvent
+
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, fmt.Errorf("parsing test output: %w", err)
+		}
+
+		switch event.Action {
+		case "build-output":
+			b, ok := buildOutputs[event.ImportPath]
+			if !ok {
+				b = &strings.Builder{}
+				buildOutputs[event.ImportPath] = b
+			}
+
+			b.WriteString(event.Output)
+
+			continue
+
+		case "build-fail":
+			continue
+		}
+
+		if event.Package == "" {
+			continue
+		}
+
+		key := testKey{event.Package, event.Test}
+		pkg := getPackage(event.Package)
+
+		switch event.Action {
+		case "output":
+			appendOutput(key, event.Output)
+
+		case "pass", "fail", "skip":
+			if event.Test == "" {
+				pkg.Status = event.Action
+				pkg.Elapsed = event.Elapsed
+
+				if event.Action == "fail" {
+					result.Passed = false
+				}
+			}
+
+			switch {
+			case event.Test == "" && event.Action == "fail" && pkg.Failed == 0:
+				var out string
+
+				if b, ok := buildOutputs[event.FailedBuild]; ok {
+					out = b.String()
+				} else if b, ok := outputs[key]; ok {
+					out = b.String()
+				}
+
+				result.Failures = append(result.Failures, TestFailure{
+					Package: event.Package,
+					Output:  out,
+				})
+
+			case event.Test != "" && event.Action == "pass":
+				pkg.Passed++
+
+			case event.Test != "" && event.Action == "skip":
+				pkg.Skipped++
+
+			case event.Test != "" && event.Action == "fail":
+				pkg.Failed++
+
+				var out string
+				if b, ok := outputs[key]; ok {
+					out = b.String()
+				}
+
+				result.Failures = append(result.Failures, TestFailure{
+					Package: event.Package,
+					Test:    event.Test,
+					Output:  out,
+				})
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("parsing test output: %w", err)
+	}
+
+	for _, pkg := range packages {
+		result.Packages = append(result.Packages, *pkg)
+	}
+
+	slices.SortFunc(result.Packages, func(a, b TestPackage) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return result, nil
+}
+
+// parseCoverageTotal parses the total coverage from the output of "go tool cover -func".
+func parseCoverageTotal(output string) (float64, error) {
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "total:" {
+			continue
+		}
+
+		coverage, err := strconv.ParseFloat(strings.TrimSuffix(fields[len(fields)-1], "%"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("parsing coverage: %w", err)
+		}
+
+		return coverage, nil
+	}
+
+	return 0, errors.New("total coverage not found in coverage report")
+}
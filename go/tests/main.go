@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"dagger/go/tests/internal/dagger"
+	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/sourcegraph/conc/pool"
@@ -19,6 +21,9 @@ func (m *Tests) All(ctx context.Context) error {
 	p.Go(m.DefaultContainer)
 	p.Go(m.CustomVersion)
 	p.Go(m.CustomContainer)
+	p.Go(m.DetectVersion)
+	p.Go(m.DetectVersion_Toolchain)
+	p.Go(m.DetectVersion_Invalid)
 	p.Go(m.EnvVars)
 	p.Go(m.Platform)
 	p.Go(m.Cgo)
@@ -26,6 +31,33 @@ func (m *Tests) All(ctx context.Context) error {
 	p.Go(m.ExecBuild)
 	p.Go(m.ExecTest)
 	p.Go(m.Source)
+	p.Go(m.Test)
+	p.Go(m.Test_Failure)
+	p.Go(m.Test_BuildFailure)
+	p.Go(m.BuildMatrix)
+	p.Go(m.BuildMatrix_Archive)
+	p.Go(m.BuildMatrix_RootPackage)
+	p.Go(m.VersionInfo)
+	p.Go(m.VersionInfo_Git)
+	p.Go(m.VersionInfo_Literal)
+	p.Go(m.Vet)
+	p.Go(m.Vulncheck)
+	p.Go(m.ModTidyCheck)
+	p.Go(m.Generate)
+	p.Go(m.Codegen)
+	p.Go(m.CodegenCheck)
+	p.Go(m.Fmt)
+	p.Go(m.FmtCheck)
+	p.Go(m.Image)
+	p.Go(m.Image_Base)
+	p.Go(m.Bench)
+	p.Go(m.CompareBench)
+	p.Go(m.Fuzz)
+	p.Go(m.Fuzz_Failure)
+	p.Go(m.Goproxy)
+	p.Go(m.GitCredentials)
+	p.Go(m.Workspace)
+	p.Go(m.Workspace_ChangedSince)
 
 	return p.Wait()
 }
@@ -58,6 +90,61 @@ func (m *Tests) CustomContainer(ctx context.Context) error {
 	return err
 }
 
+func (m *Tests) DetectVersion(ctx context.Context) error {
+	out, err := dag.Go(dagger.GoOpts{
+		Source: dag.Directory().WithNewFile("go.mod", "module example.com/app\n\ngo 1.22.5\n"),
+	}).
+		Exec([]string{"go", "env", "GOVERSION"}).
+		Stdout(ctx)
+	if err != nil {
+		return err
+	}
+
+	if out != "go1.22.5\n" {
+		return fmt.Errorf("unexpected output: wanted \"go1.22.5\", got %q", out)
+	}
+
+	return nil
+}
+
+func (m *Tests) DetectVersion_Toolchain(ctx context.Context) error {
+	source := dag.Directory().
+		WithNewFile("go.mod", "module example.com/app\n\ngo 1.21\n").
+		WithNewFile("go.work", "go 1.22.0\n\ntoolchain go1.23.1\n\nuse .\n")
+
+	out, err := dag.Go(dagger.GoOpts{
+		Source: source,
+	}).
+		Exec([]string{"go", "env", "GOVERSION"}).
+		Stdout(ctx)
+	if err != nil {
+		return err
+	}
+
+	if out != "go1.23.1\n" {
+		return fmt.Errorf("unexpected output: wanted \"go1.23.1\", got %q", out)
+	}
+
+	return nil
+}
+
+func (m *Tests) DetectVersion_Invalid(ctx context.Context) error {
+	_, err := dag.Go(dagger.GoOpts{
+		Source: dag.Directory().WithNewFile("go.mod", "module example.com/app\n\ngo 1.22.x\n"),
+	}).
+		Exec([]string{"go", "version"}).
+		Sync(ctx)
+	if err == nil {
+		return errors.New("expected an error for an invalid go directive")
+	}
+
+	if !strings.Contains(err.Error(), "cannot be mapped") {
+		return fmt.Errorf("unexpected error: %w", err)
+	}
+
+	return nil
+}
+
 func (m *Tests) EnvVars(ctx context.Context) error {
 	p := pool.New().WithErrors().WithContext(ctx)
 
@@ -371,3 +458,1103 @@ func (m *Tests) Generate(ctx context.Context) error {
 
 	return nil
 }
+
+func (m *Tests) Codegen(ctx context.Context) error {
+	out, err := dag.Go().
+		WithSource(dag.CurrentModule().Source().Directory("./testdata")).
+		Codegen(dagger.GoWithSourceCodegenOpts{Packages: []string{"./..."}}).
+		Run().
+		After().
+		File("world").
+		Contents(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(out, "hello") {
+		return fmt.Errorf("unexpected output to contain \"hello\", got %q", out)
+	}
+
+	return nil
+}
+
+func (m *Tests) CodegenCheck(ctx context.Context) error {
+	source := dag.CurrentModule().Source().Directory("./testdata")
+
+	err := dag.Go().
+		WithSource(source).
+		Codegen(dagger.GoWithSourceCodegenOpts{Packages: []string{"./..."}}).
+		Check(ctx)
+	if err == nil {
+		return errors.New("expected check to fail")
+	}
+
+	if !strings.Contains(err.Error(), "world") {
+		return fmt.Errorf("expected error to list \"world\", got %q", err)
+	}
+
+	return dag.Go().
+		WithSource(source.WithNewFile("world", "hello\n")).
+		Codegen(dagger.GoWithSourceCodegenOpts{Packages: []string{"./..."}}).
+		Check(ctx)
+}
+
+func (m *Tests) Fmt(ctx context.Context) error {
+	source := dag.Directory().
+		WithNewFile("go.mod", "module example.com/fmt\n\ngo 1.21\n").
+		WithNewFile("main.go", "package main\nfunc main() {\nprintln(\"hello\")\n}\n")
+
+	changes := dag.Go().WithSource(source).Fmt().Run()
+
+	modified, err := changes.ModifiedPaths(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(modified, []string{"main.go"}) {
+		return fmt.Errorf("unexpected modified paths: %v", modified)
+	}
+
+	out, err := changes.After().File("main.go").Contents(ctx)
+	if err != nil {
+		return err
+	}
+
+	const expected = "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n"
+
+	if out != expected {
+		return fmt.Errorf("unexpected output\nactual:   %q\nexpected: %q", out, expected)
+	}
+
+	return nil
+}
+
+func (m *Tests) FmtCheck(ctx context.Context) error {
+	source := dag.Directory().
+		WithNewFile("go.mod", "module example.com/fmt\n\ngo 1.21\n").
+		WithNewFile("main.go", "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n").
+		WithNewFile("unformatted.go", "package main\nimport \"os\"\nfunc exit() { os.Exit(1) }\n")
+
+	err := dag.Go().WithSource(source).Fmt(dagger.GoWithSourceFmtOpts{Goimports: true}).Check(ctx)
+	if err == nil {
+		return errors.New("expected check to fail")
+	}
+
+	if !strings.Contains(err.Error(), "unformatted.go") || strings.Contains(err.Error(), "main.go") {
+		return fmt.Errorf("expected error to list only \"unformatted.go\", got %q", err)
+	}
+
+	return dag.Go().WithSource(dag.CurrentModule().Source().Directory("./testdata")).Fmt().Check(ctx)
+}
+
+func (m *Tests) Test(ctx context.Context) error {
+	result := dag.Go().
+		WithSource(dag.CurrentModule().Source().Directory("./testdata")).
+		Test(dagger.GoWithSourceTestOpts{
+			Coverprofile: true,
+		})
+
+	if err := result.Check(ctx); err != nil {
+		return err
+	}
+
+	packages, err := result.Packages(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(packages) != 1 {
+		return fmt.Errorf("expected 1 package, got %d", len(packages))
+	}
+
+	passed, err := packages[0].Passed(ctx)
+	if err != nil {
+		return err
+	}
+
+	if passed != 1 {
+		return fmt.Errorf("expected 1 passed test, got %d", passed)
+	}
+
+	profile, err := result.Coverprofile().Contents(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(profile, "mode: ") {
+		return fmt.Errorf("unexpected coverage profile: %q", profile)
+	}
+
+	return nil
+}
+
+func (m *Tests) Test_Failure(ctx context.Context) error {
+	source := dag.Directory().
+		WithNewFile("go.mod", "module example.com/failure\n\ngo 1.21\n").
+		WithNewFile("failure_test.go", `package failure
+
+import "testing"
+
+func TestPass(t *testing.T) {}
+
+func TestFail(t *testing.T) {
+	t.Log("something went wrong")
+	t.Fail()
+}
+
+func TestSkip(t *testing.T) {
+	t.Skip()
+}
+`)
+
+	result := dag.Go().WithSource(source).Test()
+
+	passed, err := result.Passed(ctx)
+	if err != nil {
+		return err
+	}
+
+	if passed {
+		return errors.New("expected tests to fail")
+	}
+
+	if err := result.Check(ctx); err == nil {
+		return errors.New("expected check to fail")
+	}
+
+	failures, err := result.Failures(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(failures) != 1 {
+		return fmt.Errorf("expected 1 failure, got %d", len(failures))
+	}
+
+	test, err := failures[0].Test(ctx)
+	if err != nil {
+		return err
+	}
+
+	if test != "TestFail" {
+		return fmt.Errorf("expected TestFail to fail, got %q", test)
+	}
+
+	output, err := failures[0].Output(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(output, "something went wrong") {
+		return fmt.Errorf("expected output to contain \"something went wrong\", got %q", output)
+	}
+
+	packages, err := result.Packages(ctx)
+	if err != nil {
+		return err
+	}
+
+	skipped, err := packages[0].Skipped(ctx)
+	if err != nil {
+		return err
+	}
+
+	if skipped != 1 {
+		return fmt.Errorf("expected 1 skipped test, got %d", skipped)
+	}
+
+	return nil
+}
+
+func (m *Tests) Test_BuildFailure(ctx context.Context) error {
+	source := dag.Directory().
+		WithNewFile("go.mod", "module example.com/failure\n\ngo 1.21\n").
+		WithNewFile("failure_test.go", "package failure\n\nimport \"testing\"\n\nfunc TestBroken(t *testing.T) { undefined() }\n")
+
+	result := dag.Go().WithSource(source).Test(dagger.GoWithSourceTestOpts{
+		Coverprofile: true,
+	})
+
+	passed, err := result.Passed(ctx)
+	if err != nil {
+		return err
+	}
+
+	if passed {
+		return errors.New("expected tests to fail")
+	}
+
+	failures, err := result.Failures(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(failures) != 1 {
+		return fmt.Errorf("expected 1 failure, got %d", len(failures))
+	}
+
+	output, err := failures[0].Output(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(output, "undefined") {
+		return fmt.Errorf("expected output to contain the build error, got %q", output)
+	}
+
+	return nil
+}
+
+func (m *Tests) BuildMatrix(ctx context.Context) error {
+	dir := dag.Go().
+		WithSource(dag.CurrentModule().Source().Directory("./testdata")).
+		BuildMatrix([]dagger.Platform{"linux/amd64", "linux/arm/v7", "windows/amd64"}, dagger.GoWithSourceBuildMatrixOpts{
+			Checksum: true,
+		})
+
+	entries, err := dir.Entries(ctx)
+	if err != nil {
+		return err
+	}
+
+	expected := []string{"checksums.txt", "testdata_linux_amd64", "testdata_linux_arm_v7", "testdata_windows_amd64.exe"}
+
+	if !reflect.DeepEqual(entries, expected) {
+		return fmt.Errorf("unexpected entries\nactual:   %v\nexpected: %v", entries, expected)
+	}
+
+	out, err := dag.Container().
+		From("alpine").
+		WithFile("/app", dir.File("testdata_linux_amd64")).
+		WithExec([]string{"/app"}).
+		Stderr(ctx)
+	if err != nil {
+		return err
+	}
+
+	if out != "hello" {
+		return fmt.Errorf("unexpected output: wanted \"hello\", got %q", out)
+	}
+
+	_, err = dag.Container().
+		From("alpine").
+		WithMountedDirectory("/work", dir).
+		WithWorkdir("/work").
+		WithExec([]string{"sha256sum", "-c", "checksums.txt"}).
+		Sync(ctx)
+
+	return err
+}
+
+func (m *Tests) BuildMatrix_Archive(ctx context.Context) error {
+	dir := dag.Go().
+		WithSource(dag.CurrentModule().Source().Directory("./testdata")).
+		BuildMatrix([]dagger.Platform{"linux/amd64", "darwin/arm64"}, dagger.GoWithSourceBuildMatrixOpts{
+			Name:         "app",
+			NameTemplate: "{{.Name}}-{{.OS}}-{{.Arch}}",
+			Archive:      "tar.gz",
+		})
+
+	entries, err := dir.Entries(ctx)
+	if err != nil {
+		return err
+	}
+
+	expected := []string{"app-darwin-arm64.tar.gz", "app-linux-amd64.tar.gz"}
+
+	if !reflect.DeepEqual(entries, expected) {
+		return fmt.Errorf("unexpected entries\nactual:   %v\nexpected: %v", entries, expected)
+	}
+
+	out, err := dag.Container().
+		From("alpine").
+		WithFile("/work/app.tar.gz", dir.File("app-linux-amd64.tar.gz")).
+		WithWorkdir("/work").
+		WithExec([]string{"tar", "-xzf", "app.tar.gz"}).
+		WithExec([]string{"./app"}).
+		Stderr(ctx)
+	if err != nil {
+		return err
+	}
+
+	if out != "hello" {
+		return fmt.Errorf("unexpected output: wanted \"hello\", got %q", out)
+	}
+
+	return nil
+}
+
+func (m *Tests) BuildMatrix_RootPackage(ctx context.Context) error {
+	for _, pkg := range []string{".", "./"} {
+		entries, err := dag.Go().
+			WithSource(dag.CurrentModule().Source().Directory("./testdata")).
+			BuildMatrix([]dagger.Platform{"linux/amd64"}, dagger.GoWithSourceBuildMatrixOpts{
+				Pkg: pkg,
+			}).
+			Entries(ctx)
+		if err != nil {
+			return err
+		}
+
+		expected := []string{"testdata_linux_amd64"}
+
+		if !reflect.DeepEqual(entries, expected) {
+			return fmt.Errorf("unexpected entries for package %q\nactual:   %v\nexpected: %v", pkg, entries, expected)
+		}
+	}
+
+	return nil
+}
+
+func (m *Tests) VersionInfo(ctx context.Context) error {
+	binary := dag.Go().
+		WithSource(dag.CurrentModule().Source().Directory("./testdata")).
+		WithVersionInfo(dagger.GoWithSourceWithVersionInfoOpts{
+			Version: "1.0.0",
+		}).
+		Build(dagger.GoWithSourceBuildOpts{
+			Ldflags: []string{"-X", "main.version={{.Version}}"},
+		})
+
+	out, err := dag.Container().From("alpine").WithFile("/app", binary).WithExec([]string{"/app", "version"}).Stderr(ctx)
+	if err != nil {
+		return err
+	}
+
+	if out != "1.0.0" {
+		return fmt.Errorf("unexpected output: wanted \"1.0.0\", got %q", out)
+	}
+
+	return nil
+}
+
+func (m *Tests) VersionInfo_Git(ctx context.Context) error {
+	source := dag.Container().
+		From("alpine/git").
+		WithDirectory("/work", dag.CurrentModule().Source().Directory("./testdata")).
+		WithWorkdir("/work").
+		WithExec([]string{"git", "init"}).
+		WithExec([]string{"git", "add", "."}).
+		WithExec([]string{"git", "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-m", "initial"}).
+		WithExec([]string{"git", "tag", "v1.2.3"}).
+		Directory("/work")
+
+	binary := dag.Go().
+		WithSource(source).
+		WithGitVersionInfo().
+		Build(dagger.GoWithSourceBuildOpts{
+			Ldflags: []string{"-X", "main.version={{.Version}}"},
+		})
+
+	out, err := dag.Container().From("alpine").WithFile("/app", binary).WithExec([]string{"/app", "version"}).Stderr(ctx)
+	if err != nil {
+		return err
+	}
+
+	if out != "v1.2.3" {
+		return fmt.Errorf("unexpected output: wanted \"v1.2.3\", got %q", out)
+	}
+
+	return nil
+}
+
+// Without version information, ldflags are passed as is.
+func (m *Tests) VersionInfo_Literal(ctx context.Context) error {
+	binary := dag.Go().
+		WithSource(dag.CurrentModule().Source().Directory("./testdata")).
+		Build(dagger.GoWithSourceBuildOpts{
+			Ldflags: []string{"-X", "main.version={{.Version}}"},
+		})
+
+	out, err := dag.Container().From("alpine").WithFile("/app", binary).WithExec([]string{"/app", "version"}).Stderr(ctx)
+	if err != nil {
+		return err
+	}
+
+	if out != "{{.Version}}" {
+		return fmt.Errorf("unexpected output: wanted \"{{.Version}}\", got %q", out)
+	}
+
+	return nil
+}
+
+func (m *Tests) Vet(ctx context.Context) error {
+	source := dag.Directory().
+		WithNewFile("go.mod", "module example.com/vet\n\ngo 1.21\n").
+		WithNewFile("main.go", `package main
+
+import "fmt"
+
+func main() {
+	fmt.Printf("%d\n", "hello")
+}
+`)
+
+	report := dag.Go().WithSource(source).Vet()
+
+	findings, err := report.Findings(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(findings) != 1 {
+		return fmt.Errorf("expected 1 finding, got %d", len(findings))
+	}
+
+	code, err := findings[0].Code(ctx)
+	if err != nil {
+		return err
+	}
+
+	if code != "printf" {
+		return fmt.Errorf("expected printf finding, got %q", code)
+	}
+
+	position, err := findings[0].Position(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(position, "main.go:6:") {
+		return fmt.Errorf("unexpected position: %q", position)
+	}
+
+	if err := report.Check(ctx); err == nil {
+		return errors.New("expected check to fail")
+	}
+
+	return dag.Go().
+		WithSource(dag.CurrentModule().Source().Directory("./testdata")).
+		Vet().
+		Check(ctx)
+}
+
+func (m *Tests) Vulncheck(ctx context.Context) error {
+	return dag.Go().
+		WithSource(dag.CurrentModule().Source().Directory("./testdata")).
+		Vulncheck().
+		Check(ctx)
+}
+
+func (m *Tests) ModTidyCheck(ctx context.Context) error {
+	source := dag.Directory().
+		WithNewFile("go.mod", "module example.com/tidy\n\ngo 1.21\n").
+		WithNewFile("main.go", "package main\n\nfunc main() {}\n")
+
+	if err := dag.Go().WithSource(source).ModTidyCheck().Check(ctx); err != nil {
+		return err
+	}
+
+	// A requirement that is not used by any package
+	source = source.
+		WithNewFile("go.mod", "module example.com/tidy\n\ngo 1.21\n\nrequire example.com/unused v1.0.0\n\nreplace example.com/unused => ./unused\n").
+		WithNewFile("unused/go.mod", "module example.com/unused\n\ngo 1.21\n")
+
+	report := dag.Go().WithSource(source).ModTidyCheck()
+
+	findings, err := report.Findings(ctx)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+
+	for _, finding := range findings {
+		code, err := finding.Code(ctx)
+		if err != nil {
+			return err
+		}
+
+		if code != "mod-tidy" {
+			return fmt.Errorf("unexpected finding code: %q", code)
+		}
+
+		position, err := finding.Position(ctx)
+		if err != nil {
+			return err
+		}
+
+		paths = append(paths, position)
+	}
+
+	if !reflect.DeepEqual(paths, []string{"go.mod"}) {
+		return fmt.Errorf("expected go.mod to be reported, got %v", paths)
+	}
+
+	if err := report.Check(ctx); err == nil {
+		return errors.New("expected tidy check to fail")
+	}
+
+	return nil
+}
+
+func (m *Tests) Image(ctx context.Context) error {
+	images, err := dag.Go().
+		WithSource(dag.CurrentModule().Source().Directory("./testdata")).
+		WithVersionInfo(dagger.GoWithSourceWithVersionInfoOpts{
+			Version: "1.0.0",
+			Commit:  "0123456789abcdef",
+		}).
+		Image(ctx, dagger.GoWithSourceImageOpts{
+			Platforms: []dagger.Platform{"linux/amd64"},
+			Labels:    []string{"org.opencontainers.image.title=testdata"},
+			Ldflags:   []string{"-X", "main.version={{.Version}}"},
+		})
+	if err != nil {
+		return err
+	}
+
+	if len(images) != 1 {
+		return fmt.Errorf("expected 1 image, got %d", len(images))
+	}
+
+	out, err := images[0].WithExec([]string{"version"}, dagger.ContainerWithExecOpts{UseEntrypoint: true}).Stderr(ctx)
+	if err != nil {
+		return err
+	}
+
+	if out != "1.0.0" {
+		return fmt.Errorf("unexpected output: wanted \"1.0.0\", got %q", out)
+	}
+
+	labels := map[string]string{
+		"org.opencontainers.image.version":  "1.0.0",
+		"org.opencontainers.image.revision": "0123456789abcdef",
+		"org.opencontainers.image.title":    "testdata",
+	}
+
+	for name, expected := range labels {
+		actual, err := images[0].Label(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if actual != expected {
+			return fmt.Errorf("unexpected label %s: wanted %q, got %q", name, expected, actual)
+		}
+	}
+
+	return nil
+}
+
+func (m *Tests) Image_Base(ctx context.Context) error {
+	images, err := dag.Go().
+		WithSource(dag.CurrentModule().Source().Directory("./testdata")).
+		Image(ctx, dagger.GoWithSourceImageOpts{
+			Base:      "alpine",
+			Platforms: []dagger.Platform{"linux/amd64", "linux/arm64"},
+		})
+	if err != nil {
+		return err
+	}
+
+	if len(images) != 2 {
+		return fmt.Errorf("expected 2 images, got %d", len(images))
+	}
+
+	for i, expected := range []dagger.Platform{"linux/amd64", "linux/arm64"} {
+		platform, err := images[i].Platform(ctx)
+		if err != nil {
+			return err
+		}
+
+		if platform != expected {
+			return fmt.Errorf("unexpected platform: wanted %q, got %q", expected, platform)
+		}
+
+		entrypoint, err := images[i].Entrypoint(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !reflect.DeepEqual(entrypoint, []string{"/usr/local/bin/testdata"}) {
+			return fmt.Errorf("unexpected entrypoint: %v", entrypoint)
+		}
+	}
+
+	return nil
+}
+
+func benchSource(n int) *dagger.Directory {
+	return dag.Directory().
+		WithNewFile("go.mod", "module example.com/bench\n\ngo 1.21\n").
+		WithNewFile("bench_test.go", fmt.Sprintf(`package bench
+
+import (
+	"strings"
+	"testing"
+)
+
+func BenchmarkRepeat(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_ = strings.Repeat("a", %d)
+	}
+}
+`, n))
+}
+
+func (m *Tests) Bench(ctx context.Context) error {
+	out, err := dag.Go().
+		WithSource(benchSource(10)).
+		Bench(dagger.GoWithSourceBenchOpts{
+			Count:     2,
+			Benchtime: "100x",
+			Benchmem:  true,
+		}).
+		Contents(ctx)
+	if err != nil {
+		return err
+	}
+
+	if strings.Count(out, "BenchmarkRepeat") != 2 {
+		return fmt.Errorf("expected output to contain 2 benchmark results, got %q", out)
+	}
+
+	if !strings.Contains(out, "allocs/op") {
+		return fmt.Errorf("expected output to contain memory allocation statistics, got %q", out)
+	}
+
+	return nil
+}
+
+func (m *Tests) CompareBench(ctx context.Context) error {
+	out, err := dag.Go().
+		CompareBench(benchSource(10), benchSource(10000), dagger.GoCompareBenchOpts{
+			Benchtime: "1000x",
+		}).
+		Contents(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, expected := range []string{"base", "head", "Repeat", "sec/op"} {
+		if !strings.Contains(out, expected) {
+			return fmt.Errorf("expected output to contain %q, got %q", expected, out)
+		}
+	}
+
+	return nil
+}
+
+func fuzzSource() *dagger.Directory {
+	return dag.Directory().
+		WithNewFile("go.mod", "module example.com/fuzz\n\ngo 1.21\n").
+		WithNewFile("fuzz_test.go", `package fuzz
+
+import "testing"
+
+func FuzzPass(f *testing.F) {
+	f.Add("hello")
+
+	f.Fuzz(func(t *testing.T, s string) {})
+}
+
+func FuzzFail(f *testing.F) {
+	f.Add("a")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		if len(s) > 2 {
+			t.Fatal("too long")
+		}
+	})
+}
+`)
+}
+
+func (m *Tests) Fuzz(ctx context.Context) error {
+	return dag.Go().
+		WithSource(fuzzSource()).
+		Fuzz("FuzzPass", dagger.GoWithSourceFuzzOpts{
+			Fuzztime: "1000x",
+			Cache:    dag.CacheVolume("go-fuzz-tests"),
+		}).
+		Check(ctx)
+}
+
+func (m *Tests) Fuzz_Failure(ctx context.Context) error {
+	result := dag.Go().
+		WithSource(fuzzSource()).
+		Fuzz("FuzzFail", dagger.GoWithSourceFuzzOpts{
+			Fuzztime: "30s",
+			Cache:    dag.CacheVolume("go-fuzz-tests"),
+		})
+
+	err := result.Check(ctx)
+	if err == nil {
+		return errors.New("expected fuzzing to fail")
+	}
+
+	if !strings.Contains(err.Error(), "go test fuzz v1") {
+		return fmt.Errorf("expected error to contain the reproducer, got %q", err)
+	}
+
+	added, err := result.Changes().AddedPaths(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range added {
+		if strings.HasPrefix(p, "testdata/fuzz/FuzzFail/") && !strings.HasSuffix(p, "/") {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("expected failing input to be added under testdata/fuzz/FuzzFail, got %v", added)
+}
+
+// goproxyCertificates returns a CA certificate (ca.crt) and a certificate for the "goproxy" host signed by it (goproxy.crt, goproxy.key).
+func goproxyCertificates() *dagger.Directory {
+	script := strings.Join([]string{
+		"openssl req -x509 -newkey rsa:2048 -nodes -days 1 -subj /CN=goproxy-ca -keyout ca.key -out ca.crt",
+		"openssl req -newkey rsa:2048 -nodes -subj /CN=goproxy -keyout goproxy.key -out goproxy.csr",
+		"printf 'subjectAltName=DNS:goproxy' > goproxy.ext",
+		"openssl x509 -req -days 1 -in goproxy.csr -CA ca.crt -CAkey ca.key -CAcreateserial -extfile goproxy.ext -out goproxy.crt",
+		"rm ca.key ca.srl goproxy.csr goproxy.ext",
+	}, " && ")
+
+	return dag.Container().
+		From("alpine:latest").
+		WithExec([]string{"apk", "add", "--no-cache", "openssl"}).
+		WithWorkdir("/certs").
+		WithExec([]string{"sh", "-c", script}).
+		Directory("/certs")
+}
+
+// goproxy serves a private module over HTTPS on the default port.
+//
+// The go command only sends credentials over HTTPS, and matches .netrc machines against the host including the port.
+func goproxy(certs *dagger.Directory, auth bool) *dagger.Service {
+	const module = "example.com/private/greeting"
+	const version = "v1.0.0"
+
+	goMod := "module " + module + "\n\ngo 1.21\n"
+
+	www := dag.Container().
+		From("alpine:latest").
+		WithExec([]string{"apk", "add", "--no-cache", "zip"}).
+		WithNewFile("/src/"+module+"@"+version+"/go.mod", goMod).
+		WithNewFile("/src/"+module+"@"+version+"/greeting.go", `package greeting
+
+func Hello() string {
+	return "hello from a private module"
+}
+`).
+		WithNewFile("/www/"+module+"/@v/list", version+"\n").
+		WithNewFile("/www/"+module+"/@v/"+version+".info", `{"Version":"`+version+`","Time":"2024-01-01T00:00:00Z"}`).
+		WithNewFile("/www/"+module+"/@v/"+version+".mod", goMod).
+		WithWorkdir("/src").
+		WithExec([]string{"zip", "-r", "/www/" + module + "/@v/" + version + ".zip", "."}).
+		Directory("/www")
+
+	basicAuth := ""
+	if auth {
+		basicAuth = "\tbasic_auth {\n\t\tgopher PASSWORD_HASH\n\t}\n"
+	}
+
+	caddyfile := "https://goproxy {\n\ttls /certs/goproxy.crt /certs/goproxy.key\n" + basicAuth + "\troot * /www\n\tfile_server\n}\n"
+
+	return dag.Container().
+		From("caddy:2-alpine").
+		WithDirectory("/www", www).
+		WithDirectory("/certs", certs).
+		WithNewFile("/etc/caddy/Caddyfile", caddyfile).
+		WithExec([]string{"sh", "-c", `sed -i "s|PASSWORD_HASH|$(caddy hash-password --plaintext secret)|" /etc/caddy/Caddyfile`}).
+		WithExposedPort(443).
+		AsService(dagger.ContainerAsServiceOpts{
+			Args: []string{"caddy", "run", "--config", "/etc/caddy/Caddyfile", "--adapter", "caddyfile"},
+		})
+}
+
+// goTrusting returns a Go module (without shared caches, so that modules are always downloaded) trusting a CA certificate.
+func goTrusting(ca *dagger.File) *dagger.Go {
+	return dag.Go(dagger.GoOpts{
+		Container:    dag.Container().From("golang:latest").WithFile("/etc/ssl/certs/goproxy-ca.pem", ca),
+		DisableCache: true,
+	})
+}
+
+func privateModuleConsumer() *dagger.Directory {
+	return dag.Directory().
+		WithNewFile("go.mod", `module example.com/consumer
+
+go 1.21
+
+require example.com/private/greeting v1.0.0
+`).
+		WithNewFile("main.go", `package main
+
+import (
+	"fmt"
+
+	"example.com/private/greeting"
+)
+
+func main() {
+	fmt.Print(greeting.Hello())
+}
+`)
+}
+
+func (m *Tests) Goproxy(ctx context.Context) error {
+	certs := goproxyCertificates()
+
+	out, err := goTrusting(certs.File("ca.crt")).
+		WithSource(privateModuleConsumer()).
+		WithServiceBinding("goproxy", goproxy(certs, false)).
+		WithGoproxy("https://goproxy").
+		WithPrivateModules([]string{"example.com/private"}, dagger.GoWithSourceWithPrivateModulesOpts{
+			ViaProxy: true,
+		}).
+		Exec([]string{"sh", "-c", "go mod tidy && go run ."}).
+		Stdout(ctx)
+	if err != nil {
+		return err
+	}
+
+	if out != "hello from a private module" {
+		return fmt.Errorf("unexpected output: wanted \"hello from a private module\", got %q", out)
+	}
+
+	return nil
+}
+
+func (m *Tests) GitCredentials(ctx context.Context) error {
+	certs := goproxyCertificates()
+
+	withSource := goTrusting(certs.File("ca.crt")).
+		WithSource(privateModuleConsumer()).
+		WithServiceBinding("goproxy", goproxy(certs, true)).
+		WithGoproxy("https://goproxy").
+		WithPrivateModules([]string{"example.com/private"}, dagger.GoWithSourceWithPrivateModulesOpts{
+			ViaProxy: true,
+		})
+
+	p := pool.New().WithErrors().WithContext(ctx)
+
+	p.Go(func(ctx context.Context) error {
+		_, err := withSource.
+			Exec([]string{"go", "mod", "download", "example.com/private/greeting"}).
+			Sync(ctx)
+		if err == nil {
+			return errors.New("expected download to fail without credentials")
+		}
+
+		return nil
+	})
+
+	p.Go(func(ctx context.Context) error {
+		out, err := withSource.
+			WithGitCredentials("goproxy", "gopher", dag.SetSecret("goproxy-password", "secret")).
+			Exec([]string{"sh", "-c", "go mod tidy && go run ."}).
+			Stdout(ctx)
+		if err != nil {
+			return err
+		}
+
+		if out != "hello from a private module" {
+			return fmt.Errorf("unexpected output: wanted \"hello from a private module\", got %q", out)
+		}
+
+		return nil
+	})
+
+	return p.Wait()
+}
+
+// workspaceSource returns a workspace of three modules: app depends on lib, other is independent.
+func workspaceSource() *dagger.Directory {
+	return dag.Directory().
+		WithNewFile("go.work", `go 1.21
+
+use (
+	./app
+	./lib
+	./other
+)
+`).
+		WithNewFile("lib/go.mod", "module example.com/lib\n\ngo 1.21\n").
+		WithNewFile("lib/lib.go", `package lib
+
+func Hello() string {
+	return "hello"
+}
+`).
+		WithNewFile("lib/lib_test.go", `package lib
+
+import "testing"
+
+func TestHello(t *testing.T) {
+	if Hello() != "hello" {
+		t.Fatal("unexpected greeting")
+	}
+}
+`).
+		WithNewFile("app/go.mod", "module example.com/app\n\ngo 1.21\n\nrequire example.com/lib v0.0.0\n").
+		WithNewFile("app/main.go", `package main
+
+import (
+	"fmt"
+
+	"example.com/lib"
+)
+
+func main() {
+	fmt.Println(lib.Hello())
+}
+`).
+		WithNewFile("other/go.mod", "module example.com/other\n\ngo 1.21\n").
+		WithNewFile("other/main.go", `package main
+
+import "fmt"
+
+func main() {
+	return
+	fmt.Println("unreachable")
+}
+`)
+}
+
+func (m *Tests) Workspace(ctx context.Context) error {
+	withSource := dag.Go().WithSource(workspaceSource())
+
+	p := pool.New().WithErrors().WithContext(ctx)
+
+	p.Go(func(ctx context.Context) error {
+		modules, err := withSource.Modules(ctx)
+		if err != nil {
+			return err
+		}
+
+		expected := []string{"app", "lib", "other"}
+
+		if !reflect.DeepEqual(modules, expected) {
+			return fmt.Errorf("unexpected modules: wanted %v, got %v", expected, modules)
+		}
+
+		return nil
+	})
+
+	p.Go(func(ctx context.Context) error {
+		result := withSource.Workspace().Test(dagger.GoWorkspaceTestOpts{
+			Coverprofile: true,
+		})
+
+		err := result.Check(ctx)
+		if err != nil {
+			return err
+		}
+
+		packages, err := result.Packages(ctx)
+		if err != nil {
+			return err
+		}
+
+		var names []string
+
+		for _, pkg := range packages {
+			name, err := pkg.Name(ctx)
+			if err != nil {
+				return err
+			}
+
+			names = append(names, name)
+		}
+
+		if !slices.Contains(names, "example.com/lib") {
+			return errors.New("expected test results of example.com/lib")
+		}
+
+		profile, err := result.Coverprofile().Contents(ctx)
+		if err != nil {
+			return err
+		}
+
+		if strings.Count(profile, "mode: ") != 1 || !strings.Contains(profile, "example.com/lib/lib.go") {
+			return fmt.Errorf("unexpected merged coverage profile: %q", profile)
+		}
+
+		coverage, err := result.Coverage(ctx)
+		if err != nil {
+			return err
+		}
+
+		if coverage == 0 {
+			return errors.New("expected non-zero coverage")
+		}
+
+		return nil
+	})
+
+	p.Go(func(ctx context.Context) error {
+		findings, err := withSource.Workspace().Vet().Findings(ctx)
+		if err != nil {
+			return err
+		}
+
+		if len(findings) != 1 {
+			return fmt.Errorf("expected exactly one finding, got %d", len(findings))
+		}
+
+		position, err := findings[0].Position(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !strings.HasPrefix(position, "other/main.go:") {
+			return fmt.Errorf("expected finding in other/main.go, got %q", position)
+		}
+
+		return nil
+	})
+
+	p.Go(func(ctx context.Context) error {
+		entries, err := withSource.Workspace().Build().Glob(ctx, "*/*")
+		if err != nil {
+			return err
+		}
+
+		expected := []string{"app/app", "other/other"}
+
+		if !reflect.DeepEqual(entries, expected) {
+			return fmt.Errorf("unexpected binaries: wanted %v, got %v", expected, entries)
+		}
+
+		return nil
+	})
+
+	return p.Wait()
+}
+
+func (m *Tests) Workspace_ChangedSince(ctx context.Context) error {
+	source := dag.Container().
+		From("alpine/git").
+		WithDirectory("/src", workspaceSource()).
+		WithWorkdir("/src").
+		WithExec([]string{"sh", "-c", strings.Join([]string{
+			"git init -q",
+			"git config user.email test@example.com",
+			"git config user.name test",
+			"git add -A",
+			"git commit -qm init",
+			"git tag base",
+			"echo '// changed' >> lib/lib.go",
+		}, " && ")}).
+		Directory("/src")
+
+	modules, err := dag.Go().
+		WithSource(source).
+		Workspace().
+		ChangedSince("base").
+		Modules(ctx)
+	if err != nil {
+		return err
+	}
+
+	expected := []string{"app", "lib"}
+
+	if !reflect.DeepEqual(modules, expected) {
+		return fmt.Errorf("unexpected changed modules: wanted %v, got %v", expected, modules)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"dagger/go/internal/dagger"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// imageTagPattern matches Go versions that have a corresponding tag in the official image repository (e.g., "1.22", "1.22.3", "1.23rc1").
+var imageTagPattern = regexp.MustCompile(`^1\.[0-9]+(\.[0-9]+)?((rc|beta)[0-9]+)?$`)
+
+// detectVersion selects an image tag based on the toolchain and go directives in go.work (or go.mod) in the root of the source directory.
+func detectVersion(ctx context.Context, source *dagger.Directory) (string, error) {
+	for _, file := range []string{"go.work", "go.mod"} {
+		exists, err := source.Exists(ctx, file)
+		if err != nil {
+			return "", err
+		}
+
+		if !exists {
+			continue
+		}
+
+		content, err := source.File(file).Contents(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		version, err := parseVersion(content)
+		if err != nil {
+			return "", fmt.Errorf("detecting Go version from %s: %w", file, err)
+		}
+
+		return version, nil
+	}
+
+	return "", errors.New("detecting Go version: neither go.work nor go.mod found in source")
+}
+
+// parseVersion parses the toolchain (or if missing, the go) directive and maps it to an image tag.
+func parseVersion(content string) (string, error) {
+	var goDirective, toolchainDirective string
+
+	for _, line := range strings.Split(content, "\n") {
+		line, _, _ = strings.Cut(line, "//")
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "go":
+			goDirective = fields[1]
+
+		case "toolchain":
+			toolchainDirective = fields[1]
+		}
+	}
+
+	if toolchainDirective != "" && toolchainDirective != "default" {
+		version := strings.TrimPrefix(toolchainDirective, "go")
+		if !imageTagPattern.MatchString(version) {
+			return "", fmt.Errorf("toolchain directive %q cannot be mapped to a %s image tag", toolchainDirective, defaultImageRepository)
+		}
+
+		return version, nil
+	}
+
+	if goDirective == "" {
+		return "", errors.New("go directive not found")
+	}
+
+	if !imageTagPattern.MatchString(goDirective) {
+		return "", fmt.Errorf("go directive %q cannot be mapped to a %s image tag", goDirective, defaultImageRepository)
+	}
+
+	return goDirective, nil
+}
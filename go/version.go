@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Version information available in ldflags templates.
+type VersionInfo struct {
+	// Version of the binary (available as {{.Version}}).
+	Version string
+
+	// Commit the binary is built from (available as {{.Commit}}).
+	Commit string
+
+	// Build date (available as {{.Date}}).
+	Date string
+}
+
+// Set version information available in ldflags templates (e.g., "-X main.version={{.Version}}").
+//
+// Setting version information enables ldflags templates: ldflags containing literal "{{" have to be escaped afterwards (e.g., {{"{{"}}).
+func (m *Go) WithVersionInfo(
+	// Version of the binary (available as {{.Version}}).
+	//
+	// +optional
+	version string,
+
+	// Commit the binary is built from (available as {{.Commit}}).
+	//
+	// +optional
+	commit string,
+
+	// Build date (available as {{.Date}}).
+	//
+	// +optional
+	date string,
+) *Go {
+	m.VersionInfo = VersionInfo{
+		Version: version,
+		Commit:  commit,
+		Date:    date,
+	}
+	m.LdflagsTemplates = true
+
+	return m
+}
+
+// Set version information available in ldflags templates (e.g., "-X main.version={{.Version}}").
+func (m *WithSource) WithVersionInfo(
+	// Version of the binary (available as {{.Version}}).
+	//
+	// +optional
+	version string,
+
+	// Commit the binary is built from (available as {{.Commit}}).
+	//
+	// +optional
+	commit string,
+
+	// Build date (available as {{.Date}}).
+	//
+	// +optional
+	date string,
+) *WithSource {
+	m.Go = m.Go.WithVersionInfo(version, commit, date)
+
+	return m
+}
+
+// Derive version information from the Git repository (.git directory) in the source directory.
+//
+// The version is the output of "git describe --tags --always --dirty",
+// the commit is the full hash of HEAD and the date is the commit date of HEAD (in strict ISO 8601 format).
+func (m *WithSource) WithGitVersionInfo(ctx context.Context) (*WithSource, error) {
+	script := strings.Join([]string{
+		"git config --global --add safe.directory '*'",
+		"git describe --tags --always --dirty",
+		"git rev-parse HEAD",
+		"git log -1 --format=%cI",
+	}, " && ")
+
+	out, err := m.Container().
+		WithExec([]string{"sh", "-c", script}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("deriving version information from git (is the .git directory included in the source?): %w", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		return nil, fmt.Errorf("unexpected git output: %q", out)
+	}
+
+	return m.WithVersionInfo(lines[0], lines[1], lines[2]), nil
+}
+
+// renderLdflags executes ldflags as templates with the version information (if set).
+func (m *Go) renderLdflags(ldflags []string) ([]string, error) {
+	if !m.LdflagsTemplates {
+		return ldflags, nil
+	}
+
+	rendered := make([]string, 0, len(ldflags))
+
+	var errs []error
+
+	for _, ldflag := range ldflags {
+		tpl, err := template.New("ldflags").Option("missingkey=error").Parse(ldflag)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("parsing ldflags template %q: %w", ldflag, err))
+
+			continue
+		}
+
+		var buf bytes.Buffer
+
+		if err := tpl.Execute(&buf, m.VersionInfo); err != nil {
+			errs = append(errs, fmt.Errorf("executing ldflags template %q: %w", ldflag, err))
+
+			continue
+		}
+
+		rendered = append(rendered, buf.String())
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return rendered, nil
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"context"
+	"dagger/go/internal/dagger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// List the modules in the source directory.
+//
+// If the source contains a go.work file, the modules used by the workspace are returned.
+// Otherwise, the source is expected to be a single module (returned as ".").
+func (m *WithSource) Modules(ctx context.Context) ([]string, error) {
+	exists, err := m.Source.Exists(ctx, "go.work")
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return []string{"."}, nil
+	}
+
+	out, err := m.Go.Container.
+		WithWorkdir(workdir).
+		WithMountedDirectory(workdir, m.Source).
+		WithExec([]string{"go", "work", "edit", "-json"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseWorkspaceModules(out)
+}
+
+// parseWorkspaceModules parses the output of "go work edit -json".
+func parseWorkspaceModules(output string) ([]string, error) {
+	var work struct {
+		Use []struct {
+			DiskPath string
+		}
+	}
+
+	if err := json.Unmarshal([]byte(output), &work); err != nil {
+		return nil, fmt.Errorf("parsing go.work: %w", err)
+	}
+
+	modules := make([]string, 0, len(work.Use))
+
+	for _, use := range work.Use {
+		if path.IsAbs(use.DiskPath) || strings.HasPrefix(path.Clean(use.DiskPath), "../") {
+			return nil, fmt.Errorf("module %q is outside of the source directory", use.DiskPath)
+		}
+
+		modules = append(modules, path.Clean(use.DiskPath))
+	}
+
+	slices.Sort(modules)
+
+	return slices.Compact(modules), nil
+}
+
+// Run commands on every module of a Go workspace (see Modules).
+func (m *WithSource) Workspace(ctx context.Context) (*Workspace, error) {
+	modules, err := m.Modules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Workspace{
+		Modules:    modules,
+		WithSource: m,
+	}, nil
+}
+
+// Modules of a Go workspace.
+//
+// Commands run in every module in parallel and their results are aggregated.
+type Workspace struct {
+	// Directories of the modules (relative to the source directory).
+	Modules []string
+
+	// +private
+	WithSource *WithSource
+}
+
+func (m *Workspace) module(dir string) *WithSource {
+	w := m.WithSource.clone()
+	w.Dir = dir
+
+	return w
+}
+
+// Only keep modules affected by changes since a git reference (including uncommitted and untracked files).
+//
+// A module is affected if any of its files changed or if it depends on an affected module of the workspace.
+// Changes to go.work or go.work.sum affect every module.
+//
+// The source directory must contain the .git directory.
+func (m *Workspace) ChangedSince(
+	ctx context.Context,
+
+	// Git reference (e.g., "origin/main", a tag or a commit hash) to compare to.
+	ref string,
+) (*Workspace, error) {
+	script := strings.Join([]string{
+		"git config --global --add safe.directory '*'",
+		"git diff --name-only --relative " + strconv.Quote(ref) + " --",
+		"git ls-files --others --exclude-standard",
+	}, " && ")
+
+	out, err := m.WithSource.Go.Container.
+		WithWorkdir(workdir).
+		WithMountedDirectory(workdir, m.WithSource.Source).
+		WithExec([]string{"sh", "-c", script}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing changes since %s (is the .git directory included in the source?): %w", ref, err)
+	}
+
+	changed := map[string]bool{}
+
+	for _, file := range strings.Split(out, "\n") {
+		if file == "" {
+			continue
+		}
+
+		if file == "go.work" || file == "go.work.sum" {
+			return m, nil
+		}
+
+		if module, ok := owningModule(m.Modules, file); ok {
+			changed[module] = true
+		}
+	}
+
+	dependencies, err := m.dependencies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// propagate changes to dependent modules until nothing changes
+	for propagated := true; propagated; {
+		propagated = false
+
+		for _, module := range m.Modules {
+			if changed[module] {
+				continue
+			}
+
+			if slices.ContainsFunc(dependencies[module], func(dep string) bool { return changed[dep] }) {
+				changed[module] = true
+				propagated = true
+			}
+		}
+	}
+
+	modules := slices.DeleteFunc(slices.Clone(m.Modules), func(module string) bool {
+		return !changed[module]
+	})
+
+	return &Workspace{
+		Modules:    modules,
+		WithSource: m.WithSource,
+	}, nil
+}
+
+// owningModule returns the (innermost) module a file belongs to.
+func owningModule(modules []string, file string) (string, bool) {
+	var owner string
+	var found bool
+
+	for _, module := range modules {
+		if module != "." && file != module && !strings.HasPrefix(file, module+"/") {
+			continue
+		}
+
+		if !found || len(module) > len(owner) || owner == "." {
+			owner = module
+			found = true
+		}
+	}
+
+	return owner, found
+}
+
+// dependencies returns the modules of the workspace each module requires (directly).
+func (m *Workspace) dependencies(ctx context.Context) (map[string][]string, error) {
+	args := []string{"sh", "-c", `for f in "$@"; do go mod edit -json "$f"; done`, "sh"}
+
+	for _, module := range m.Modules {
+		args = append(args, path.Join(module, "go.mod"))
+	}
+
+	out, err := m.WithSource.Go.Container.
+		WithWorkdir(workdir).
+		WithMountedDirectory(workdir, m.WithSource.Source).
+		WithExec(args).
+		Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type goMod struct {
+		Module struct {
+			Path string
+		}
+		Require []struct {
+			Path string
+		}
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(out))
+
+	mods := make([]goMod, 0, len(m.Modules))
+
+	for {
+		var mod goMod
+
+		err := decoder.Decode(&mod)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parsing go.mod: %w", err)
+		}
+
+		mods = append(mods, mod)
+	}
+
+	if len(mods) != len(m.Modules) {
+		return nil, fmt.Errorf("expected %d go.mod files, parsed %d", len(m.Modules), len(mods))
+	}
+
+	dirs := map[string]string{}
+	for i, mod := range mods {
+		dirs[mod.Module.Path] = m.Modules[i]
+	}
+
+	dependencies := map[string][]string{}
+
+	for i, mod := range mods {
+		for _, require := range mod.Require {
+			if dir, ok := dirs[require.Path]; ok {
+				dependencies[m.Modules[i]] = append(dependencies[m.Modules[i]], dir)
+			}
+		}
+	}
+
+	return dependencies, nil
+}
+
+// Run tests in every module (see WithSource.Test) and aggregate the results.
+func (m *Workspace) Test(
+	ctx context.Context,
+
+	// Run only those tests, examples, fuzz tests and benchmarks matching the regular expression.
+	//
+	// +optional
+	run string,
+
+	// Enable data race detection.
+	//
+	// +optional
+	race bool,
+
+	// Run each test, benchmark and fuzz seed n times (1 disables the test cache).
+	//
+	// +optional
+	count int,
+
+	// Tell long-running tests to shorten their run time.
+	//
+	// +optional
+	short bool,
+
+	// If a test binary runs longer than the specified duration, panic (e.g., "10m").
+	//
+	// +optional
+	timeout string,
+
+	// Collect a coverage profile (merged across modules).
+	//
+	// +optional
+	coverprofile bool,
+
+	// A list of additional build tags to consider satisfied during the build.
+	//
+	// +optional
+	tags []string,
+) (*TestResult, error) {
+	const coverprofilePath = "/work/coverage.out"
+
+	results := make([]*TestResult, len(m.Modules))
+
+	g, gctx := errgroup.WithContext(ctx)
+
+	for i, module := range m.Modules {
+		g.Go(func() error {
+			result, err := m.module(module).Test(gctx, nil, run, race, count, short, timeout, coverprofile, tags)
+			if err != nil {
+				return fmt.Errorf("testing module %s: %w", module, err)
+			}
+
+			results[i] = result
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	aggregated := &TestResult{
+		Passed: true,
+	}
+
+	var output strings.Builder
+	var profiles []string
+
+	for _, result := range results {
+		aggregated.Passed = aggregated.Passed && result.Passed
+		aggregated.Packages = append(aggregated.Packages, result.Packages...)
+		aggregated.Failures = append(aggregated.Failures, result.Failures...)
+
+		contents, err := result.Output.Contents(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		output.WriteString(contents)
+
+		// modules failing to build have no coverage profile
+		if result.Coverprofile != nil {
+			profile, err := result.Coverprofile.Contents(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			profiles = append(profiles, profile)
+		}
+	}
+
+	aggregated.Output = dag.Directory().WithNewFile("test.json", output.String()).File("test.json")
+
+	if len(profiles) == 0 {
+		return aggregated, nil
+	}
+
+	profile, err := mergeCoverprofiles(profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregated.Coverprofile = dag.Directory().WithNewFile("coverage.out", profile).File("coverage.out")
+
+	// profiles refer to packages by import path: resolve them from the root of the workspace
+	out, err := m.WithSource.Container().
+		WithMountedFile(coverprofilePath, aggregated.Coverprofile).
+		WithExec([]string{"go", "tool", "cover", "-func", coverprofilePath}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregated.Coverage, err = parseCoverageTotal(out)
+	if err != nil {
+		return nil, err
+	}
+
+	return aggregated, nil
+}
+
+// mergeCoverprofiles merges coverage profiles of different modules (their blocks do not overlap).
+func mergeCoverprofiles(profiles []string) (string, error) {
+	var mode string
+	var b strings.Builder
+
+	for _, profile := range profiles {
+		header, blocks, _ := strings.Cut(profile, "\n")
+
+		if !strings.HasPrefix(header, "mode: ") {
+			return "", fmt.Errorf("invalid coverage profile header: %q", header)
+		}
+
+		if mode == "" {
+			mode = header
+			b.WriteString(header + "\n")
+		} else if header != mode {
+			return "", fmt.Errorf("coverage profiles have different modes: %q and %q", mode, header)
+		}
+
+		b.WriteString(blocks)
+
+		if blocks != "" && !strings.HasSuffix(blocks, "\n") {
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String(), nil
+}
+
+// Run "go vet" in every module (see WithSource.Vet) and aggregate the reported problems.
+func (m *Workspace) Vet(
+	ctx context.Context,
+
+	// A list of additional build tags to consider satisfied during the build.
+	//
+	// +optional
+	tags []string,
+) (*Report, error) {
+	reports := make([]*Report, len(m.Modules))
+
+	g, gctx := errgroup.WithContext(ctx)
+
+	for i, module := range m.Modules {
+		g.Go(func() error {
+			report, err := m.module(module).Vet(gctx, nil, tags)
+			if err != nil {
+				return fmt.Errorf("vetting module %s: %w", module, err)
+			}
+
+			reports[i] = report
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+
+	for _, report := range reports {
+		findings = append(findings, report.Findings...)
+	}
+
+	sortFindings(findings)
+
+	return &Report{
+		Findings: findings,
+	}, nil
+}
+
+// Build every main package of every module.
+//
+// The resulting directory contains the binaries of each module in a directory named after the module directory.
+// Every module is built (even if some fail) and build errors are aggregated.
+func (m *Workspace) Build(
+	ctx context.Context,
+
+	// Enable data race detection.
+	//
+	// +optional
+	race bool,
+
+	// Arguments to pass on each go tool link invocation.
+	//
+	// Once version information is set (see WithVersionInfo), arguments are rendered as templates (e.g., "-X main.version={{.Version}}").
+	//
+	// +optional
+	ldflags []string,
+
+	// A list of additional build tags to consider satisfied during the build.
+	//
+	// +optional
+	tags []string,
+
+	// Remove all file system paths from the resulting executable.
+	//
+	// +optional
+	trimpath bool,
+
+	// Target platform in "[os]/[platform]/[version]" format (e.g., "darwin/arm64/v7", "windows/amd64", "linux/arm64").
+	//
+	// +optional
+	platform dagger.Platform,
+) (*dagger.Directory, error) {
+	const outputPath = "/work/out"
+
+	// go build writes the binaries of every main package to a directory if the output path ends with a slash
+	args := []string{"go", "build", "-o", outputPath + "/"}
+
+	if race {
+		args = append(args, "-race")
+	}
+
+	ldflags, err := m.WithSource.Go.renderLdflags(ldflags)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ldflags) > 0 {
+		args = append(args, "-ldflags", strings.Join(ldflags, " "))
+	}
+
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+
+	if trimpath {
+		args = append(args, "-trimpath")
+	}
+
+	args = append(args, "./...")
+
+	outputs := make([]*dagger.Directory, len(m.Modules))
+	errs := make([]error, len(m.Modules))
+
+	var g errgroup.Group
+
+	for i, module := range m.Modules {
+		g.Go(func() error {
+			w := m.module(module)
+			if platform != "" {
+				w = w.WithPlatform(platform)
+			}
+
+			output := w.Container().
+				WithDirectory(outputPath, dag.Directory()).
+				WithExec(args).
+				Directory(outputPath)
+
+			output, err := output.Sync(ctx)
+			if err != nil {
+				errs[i] = fmt.Errorf("building module %s: %w", module, err)
+
+				return nil
+			}
+
+			outputs[i] = output
+
+			return nil
+		})
+	}
+
+	_ = g.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	dir := dag.Directory()
+
+	for i, module := range m.Modules {
+		dir = dir.WithDirectory(module, outputs[i])
+	}
+
+	return dir, nil
+}
@@ -105,6 +105,18 @@ func (p *Package) WithKubeconfigSecret(secret *dagger.Secret) *Package {
 	return p
 }
 
+// Run Helm against a local cluster.
+func (p *Package) WithCluster(ctx context.Context, cluster *Cluster) (*Package, error) {
+	helm, err := p.Helm.WithCluster(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Helm = helm
+
+	return p, nil
+}
+
 // Publishes this Helm chart package to an OCI registry.
 //
 // +cache="never"
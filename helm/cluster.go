@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"dagger/helm/internal/dagger"
+	"fmt"
+	"time"
+)
+
+// defaultClusterImageRepository is used to run local clusters.
+const defaultClusterImageRepository = "rancher/k3s"
+
+// defaultClusterVersion is the default version (image tag) of k3s.
+const defaultClusterVersion = "v1.31.4-k3s1"
+
+// k3sServerScript starts a k3s server from a clean state.
+//
+// The data directory is a cache volume (containerd does not work on top of the container overlay filesystem),
+// so the datastore and the kubeconfig of the previous run are removed first.
+// Images pulled by previous runs are kept.
+const k3sServerScript = `set -e
+
+# cgroup v2: move processes out of the root cgroup, so that controllers can be delegated to nested containers
+if [ -f /sys/fs/cgroup/cgroup.controllers ]; then
+	mkdir -p /sys/fs/cgroup/init
+	xargs -rn1 < /sys/fs/cgroup/cgroup.procs > /sys/fs/cgroup/init/cgroup.procs || :
+	sed -e 's/ / +/g' -e 's/^/+/' < /sys/fs/cgroup/cgroup.controllers > /sys/fs/cgroup/cgroup.subtree_control
+fi
+
+rm -f /etc/rancher/k3s/k3s.yaml
+rm -rf /var/lib/rancher/k3s/server/db
+
+exec k3s server --disable traefik --disable metrics-server --egress-selector-mode disabled --tls-san "$K3S_HOSTNAME"
+`
+
+// A local Kubernetes cluster (running k3s).
+type Cluster struct {
+	// Kubernetes API server (listening on port 6443).
+	//
+	// Start the service explicitly to keep the cluster (and its state) running between calls.
+	Service *dagger.Service
+
+	// +private
+	Name string
+
+	// +private
+	Container *dagger.Container
+}
+
+// Launch a local Kubernetes cluster (running k3s) as a service.
+//
+// Use WithCluster to run Helm against the cluster.
+func (m *Helm) Cluster(
+	// Name of the cluster. Also used as the hostname of the Kubernetes API server.
+	//
+	// The state of the cluster is kept in cache volumes named after the cluster: use distinct names for clusters running concurrently.
+	name string,
+
+	// Version (image tag) to use from the official k3s image repository.
+	//
+	// +optional
+	// +default="v1.31.4-k3s1"
+	version string,
+) *Cluster {
+	if version == "" {
+		version = defaultClusterVersion
+	}
+
+	container := dag.Container().
+		From(fmt.Sprintf("%s:%s", defaultClusterImageRepository, version)).
+		WithoutEntrypoint().
+		WithEnvVariable("K3S_HOSTNAME", name).
+		WithMountedCache("/etc/rancher/k3s", dag.CacheVolume("helm-cluster-config-"+name)).
+		WithMountedCache("/var/lib/rancher", dag.CacheVolume("helm-cluster-data-"+name)).
+		WithMountedTemp("/var/lib/cni").
+		WithMountedTemp("/var/lib/kubelet").
+		WithMountedTemp("/var/log")
+
+	service := container.
+		WithExposedPort(6443).
+		AsService(dagger.ContainerAsServiceOpts{
+			Args:                     []string{"sh", "-c", k3sServerScript},
+			InsecureRootCapabilities: true,
+		})
+
+	return &Cluster{
+		Service:   service,
+		Name:      name,
+		Container: container,
+	}
+}
+
+// Returns the kubeconfig to connect to the cluster.
+//
+// The kubeconfig points to the cluster name as a hostname: bind the service using the cluster name as an alias (see WithCluster).
+//
+// +cache="session"
+func (c *Cluster) Kubeconfig(ctx context.Context) (*dagger.Secret, error) {
+	const script = `for i in $(seq 1 120); do
+	if [ -f /etc/rancher/k3s/k3s.yaml ]; then
+		exec sed "s|https://127.0.0.1:6443|https://$K3S_HOSTNAME:6443|" /etc/rancher/k3s/k3s.yaml
+	fi
+
+	sleep 1
+done
+
+echo "timed out waiting for the kubeconfig" >&2
+exit 1
+`
+
+	kubeconfig, err := c.Container.
+		WithServiceBinding(c.Name, c.Service).
+		WithEnvVariable("CACHE_BUSTER", time.Now().Format(time.RFC3339Nano)).
+		WithExec([]string{"sh", "-c", script}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return dag.SetSecret("helm-cluster-kubeconfig-"+c.Name, kubeconfig), nil
+}
+
+// Run Helm against a local cluster.
+func (m *Helm) WithCluster(ctx context.Context, cluster *Cluster) (*Helm, error) {
+	kubeconfig, err := cluster.Kubeconfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Container = m.Container.WithServiceBinding(cluster.Name, cluster.Service)
+
+	return m.WithKubeconfigSecret(kubeconfig), nil
+}
@@ -19,6 +19,9 @@ type Helm struct {
 
 	// +private
 	RegistryConfig *dagger.RegistryConfig
+
+	// +private
+	Repositories []Repository
 }
 
 func New(
@@ -45,7 +48,8 @@ func New(
 		// Do not allow overriding Helm path locations (when using a custom image or container).
 		// TODO: add other paths: https://helm.sh/docs/helm/helm/
 		WithoutEnvVariable("HELM_HOME").
-		WithoutEnvVariable("HELM_REGISTRY_CONFIG")
+		WithoutEnvVariable("HELM_REGISTRY_CONFIG").
+		WithoutEnvVariable("HELM_REPOSITORY_CONFIG")
 
 	// Disable cache mounts for now.
 	// Need to figure out if they are needed at all.
@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"dagger/helm/internal/dagger"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -191,13 +194,13 @@ func (c *Chart) Install(
 		WithMountedDirectory(chartPath, c.Directory).
 		WithDirectory("/work/values", dag.Directory())
 
-	return install(
+	return installOrUpgrade(
 		ctx,
 
 		c.Helm,
 
 		name,
-		chartPath,
+		[]string{"helm", "install", name, chartPath},
 		container,
 
 		atomic,
@@ -415,13 +418,13 @@ func (p *Package) Install(
 		WithMountedFile(chartPath, p.File).
 		WithDirectory("/work/values", dag.Directory())
 
-	return install(
+	return installOrUpgrade(
 		ctx,
 
 		p.Helm,
 
 		name,
-		chartPath,
+		[]string{"helm", "install", name, chartPath},
 		container,
 
 		atomic,
@@ -454,14 +457,244 @@ func (p *Package) Install(
 	)
 }
 
-// Install a Helm chart.
-func install(
+// Upgrade a Helm release to a new version of a chart.
+//
+// +cache="never"
+func (c *Chart) Upgrade(
+	ctx context.Context,
+
+	// Helm release name.
+	name string,
+
+	// If a release by this name doesn't already exist, run an install.
+	//
+	// +optional
+	install bool,
+
+	// If set, upgrade process rolls back changes made in case of failed upgrade. Wait flag will be set automatically if atomic is used.
+	//
+	// +optional
+	atomic bool,
+
+	// Verify certificates of HTTPS-enabled servers using this CA bundle.
+	//
+	// +optional
+	caFile *dagger.File,
+
+	// Identify HTTPS client using this SSL certificate file.
+	//
+	// +optional
+	certFile *dagger.File,
+
+	// Allow deletion of new resources created in this upgrade when upgrade fails.
+	//
+	// +optional
+	cleanupOnFail bool,
+
+	// If install is set, create the release namespace if not present.
+	//
+	// +optional
+	createNamespace bool,
+
+	// Update dependencies if they are missing before installing the chart.
+	//
+	// +optional
+	dependencyUpdate bool,
+
+	// Add a custom description.
+	//
+	// +optional
+	description string,
+
+	// If set, the upgrade process will not validate rendered templates against the Kubernetes OpenAPI Schema.
+	//
+	// +optional
+	disableOpenapiValidation bool,
+
+	// Enable DNS lookups when rendering templates.
+	//
+	// +optional
+	enableDns bool,
+
+	// Force resource updates through a replacement strategy.
+	//
+	// +optional
+	force bool,
+
+	// Limit the maximum number of revisions saved per release. Use 0 for no limit.
+	//
+	// +optional
+	// +default=10
+	historyMax int,
+
+	// Skip tls certificate checks for the chart download.
+	//
+	// +optional
+	insecureSkipTlsVerify bool,
+
+	// Identify HTTPS client using this SSL key file.
+	//
+	// +optional
+	keyFile *dagger.Secret,
+
+	// Labels that would be added to release metadata.
+	//
+	// +optional
+	labels []string,
+
+	// Disable pre/post upgrade hooks.
+	//
+	// +optional
+	noHooks bool,
+
+	// Use insecure HTTP connections for the chart download.
+	//
+	// +optional
+	plainHttp bool,
+
+	// The path to an executable to be used for post rendering. If it exists in $PATH, the binary will be used, otherwise it will try to look for the executable at the given path.
+	//
+	// +optional
+	postRenderer string,
+
+	// Arguments to the post-renderer.
+	//
+	// +optional
+	postRendererArgs []string,
+
+	// If set, render subchart notes along with the parent.
+	//
+	// +optional
+	renderSubchartNotes bool,
+
+	// When upgrading, reset the values to the ones built into the chart.
+	//
+	// +optional
+	resetValues bool,
+
+	// When upgrading, reuse the last release's values and merge in any overrides from values.
+	//
+	// +optional
+	reuseValues bool,
+
+	// If set, no CRDs will be installed when an upgrade is performed with install flag enabled.
+	//
+	// +optional
+	skipCrds bool,
+
+	// Time to wait for any individual Kubernetes operation (like Jobs for hooks).
+	//
+	// +optional
+	timeout string,
+
+	// Specify values in a YAML file.
+	//
+	// +optional
+	values []*dagger.File,
+
+	// Verify the package before using it.
+	//
+	// +optional
+	verify bool,
+
+	// If set, will wait until all Pods, PVCs, Services, and minimum number of Pods of a Deployment, StatefulSet, or ReplicaSet are in a ready state before marking the release as successful. It will wait for as long as timeout.
+	//
+	// +optional
+	wait bool,
+
+	// If set and wait enabled, will wait until all Jobs have been completed before marking the release as successful. It will wait for as long as timeout.
+	//
+	// +optional
+	waitForJobs bool,
+
+	// Global options
+
+	// Namespace scope for this request.
+	//
+	// +optional
+	namespace string,
+) (*Release, error) {
+	chartMetadata, err := getChartMetadata(ctx, c.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	chartName := chartMetadata.Name
+	chartPath := filepath.Join("/work/chart", chartName)
+
+	container := c.Helm.container().
+		WithMountedDirectory(chartPath, c.Directory).
+		WithDirectory("/work/values", dag.Directory())
+
+	args := []string{"helm", "upgrade", name, chartPath}
+
+	if install {
+		args = append(args, "--install")
+	}
+
+	if cleanupOnFail {
+		args = append(args, "--cleanup-on-fail")
+	}
+
+	args = append(args, "--history-max", strconv.Itoa(historyMax))
+
+	if resetValues {
+		args = append(args, "--reset-values")
+	}
+
+	if reuseValues {
+		args = append(args, "--reuse-values")
+	}
+
+	return installOrUpgrade(
+		ctx,
+
+		c.Helm,
+
+		name,
+		args,
+		container,
+
+		atomic,
+		caFile,
+		certFile,
+		createNamespace,
+		dependencyUpdate,
+		description,
+		disableOpenapiValidation,
+		enableDns,
+		force,
+		false, // generateName is not supported by upgrade
+		insecureSkipTlsVerify,
+		keyFile,
+		labels,
+		"", // nameTemplate is not supported by upgrade
+		noHooks,
+		plainHttp,
+		postRenderer,
+		postRendererArgs,
+		renderSubchartNotes,
+		false, // replace is not supported by upgrade
+		skipCrds,
+		timeout,
+		values,
+		verify,
+		wait,
+		waitForJobs,
+		namespace,
+	)
+}
+
+// Install or upgrade a Helm chart.
+//
+// args is the install or upgrade command (including the release name, the chart and any command specific flags).
+func installOrUpgrade(
 	ctx context.Context,
 
 	helm *Helm,
 
 	name string,
-	chartPath string,
+	args []string,
 	container *dagger.Container,
 
 	atomic bool,
@@ -505,8 +738,6 @@ func install(
 
 	namespace string,
 ) (*Release, error) {
-	args := []string{"helm", "install", name, chartPath}
-
 	if atomic {
 		args = append(args, "--atomic")
 	}
@@ -626,7 +857,7 @@ func install(
 		args = append(args, "--namespace", namespace)
 	}
 
-	container, err := container.WithExec(args).Sync(ctx)
+	container, err := container.WithEnvVariable("CACHE_BUSTER", time.Now().Format(time.RFC3339Nano)).WithExec(args).Sync(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -646,6 +877,23 @@ type Release struct {
 	Container *dagger.Container
 }
 
+// Returns an existing Helm release (e.g., to run day-2 operations on it).
+func (m *Helm) Release(
+	// Helm release name.
+	name string,
+
+	// Namespace of the release.
+	//
+	// +optional
+	namespace string,
+) *Release {
+	return &Release{
+		Name:      name,
+		Namespace: namespace,
+		Container: m.container(),
+	}
+}
+
 // Run Helm tests.
 func (r *Release) Test(
 	ctx context.Context,
@@ -690,3 +938,307 @@ func (r *Release) Test(
 
 	return r.Container.WithExec(args).Stdout(ctx)
 }
+
+// Roll back the release to a previous revision.
+//
+// +cache="never"
+func (r *Release) Rollback(
+	ctx context.Context,
+
+	// Revision to roll back to. If omitted, the release is rolled back to the previous revision.
+	//
+	// +optional
+	revision int,
+
+	// Allow deletion of new resources created in this rollback when rollback fails.
+	//
+	// +optional
+	cleanupOnFail bool,
+
+	// Force resource update through delete/recreate if needed.
+	//
+	// +optional
+	force bool,
+
+	// Prevent hooks from running during rollback.
+	//
+	// +optional
+	noHooks bool,
+
+	// If set, will wait until all Pods, PVCs, Services, and minimum number of Pods of a Deployment, StatefulSet, or ReplicaSet are in a ready state before marking the release as successful. It will wait for as long as timeout.
+	//
+	// +optional
+	wait bool,
+
+	// Time to wait for any individual Kubernetes operation (like Jobs for hooks) (default 5m0s).
+	//
+	// +optional
+	timeout string,
+) (*Release, error) {
+	args := []string{"helm", "rollback", r.Name}
+
+	if revision > 0 {
+		args = append(args, strconv.Itoa(revision))
+	}
+
+	if cleanupOnFail {
+		args = append(args, "--cleanup-on-fail")
+	}
+
+	if force {
+		args = append(args, "--force")
+	}
+
+	if noHooks {
+		args = append(args, "--no-hooks")
+	}
+
+	if wait {
+		args = append(args, "--wait")
+	}
+
+	if timeout != "" {
+		_, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, "--timeout", timeout)
+	}
+
+	if r.Namespace != "" {
+		args = append(args, "--namespace", r.Namespace)
+	}
+
+	_, err := r.Container.WithEnvVariable("CACHE_BUSTER", time.Now().Format(time.RFC3339Nano)).WithExec(args).Sync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Uninstall the release.
+//
+// +cache="never"
+func (r *Release) Uninstall(
+	ctx context.Context,
+
+	// Remove all associated resources and mark the release as deleted, but retain the release history.
+	//
+	// +optional
+	keepHistory bool,
+
+	// If set, will wait until all the resources are deleted before returning. It will wait for as long as timeout.
+	//
+	// +optional
+	wait bool,
+
+	// Time to wait for any individual Kubernetes operation (like Jobs for hooks) (default 5m0s).
+	//
+	// +optional
+	timeout string,
+) error {
+	args := []string{"helm", "uninstall", r.Name}
+
+	if keepHistory {
+		args = append(args, "--keep-history")
+	}
+
+	if wait {
+		args = append(args, "--wait")
+	}
+
+	if timeout != "" {
+		_, err := time.ParseDuration(timeout)
+		if err != nil {
+			return err
+		}
+
+		args = append(args, "--timeout", timeout)
+	}
+
+	if r.Namespace != "" {
+		args = append(args, "--namespace", r.Namespace)
+	}
+
+	_, err := r.Container.WithEnvVariable("CACHE_BUSTER", time.Now().Format(time.RFC3339Nano)).WithExec(args).Sync(ctx)
+
+	return err
+}
+
+// Status of a Helm release.
+type ReleaseStatus struct {
+	// Release name.
+	Name string
+
+	// Namespace of the release.
+	Namespace string
+
+	// Current revision of the release.
+	Revision int
+
+	// Status of the current revision (e.g., deployed, failed, uninstalled).
+	Status string
+
+	// Description of the current revision (e.g., "Install complete").
+	Description string
+
+	// Name of the deployed chart.
+	Chart string
+
+	// Version of the deployed chart.
+	ChartVersion string
+
+	// Version of the application deployed by the chart.
+	AppVersion string
+
+	// Time of the first deployment (RFC 3339).
+	FirstDeployed string
+
+	// Time of the last deployment (RFC 3339).
+	LastDeployed string
+
+	// Rendered notes of the chart.
+	Notes string
+}
+
+// Show the status of the release.
+//
+// +cache="never"
+func (r *Release) Status(ctx context.Context) (*ReleaseStatus, error) {
+	args := []string{"helm", "status", r.Name, "--output", "json"}
+
+	if r.Namespace != "" {
+		args = append(args, "--namespace", r.Namespace)
+	}
+
+	output, err := r.Container.WithEnvVariable("CACHE_BUSTER", time.Now().Format(time.RFC3339Nano)).WithExec(args).Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseReleaseStatus(output)
+}
+
+// A revision of a Helm release.
+type ReleaseRevision struct {
+	// Revision number.
+	Revision int
+
+	// Time of the revision (RFC 3339).
+	Updated string
+
+	// Status of the revision (e.g., deployed, superseded, failed).
+	Status string
+
+	// Chart used for the revision (e.g., "foo-0.1.0").
+	Chart string
+
+	// Version of the application deployed by the chart.
+	AppVersion string
+
+	// Description of the revision (e.g., "Upgrade complete").
+	Description string
+}
+
+// Show the revision history of the release.
+//
+// +cache="never"
+func (r *Release) History(
+	ctx context.Context,
+
+	// Maximum number of revisions to include in the history (default 256).
+	//
+	// +optional
+	max int,
+) ([]ReleaseRevision, error) {
+	args := []string{"helm", "history", r.Name, "--output", "json"}
+
+	if max > 0 {
+		args = append(args, "--max", strconv.Itoa(max))
+	}
+
+	if r.Namespace != "" {
+		args = append(args, "--namespace", r.Namespace)
+	}
+
+	output, err := r.Container.WithEnvVariable("CACHE_BUSTER", time.Now().Format(time.RFC3339Nano)).WithExec(args).Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseReleaseHistory(output)
+}
+
+// parseReleaseStatus parses the output of "helm status --output json".
+func parseReleaseStatus(output string) (*ReleaseStatus, error) {
+	var release struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		Version   int    `json:"version"`
+		Info      struct {
+			FirstDeployed string `json:"first_deployed"`
+			LastDeployed  string `json:"last_deployed"`
+			Description   string `json:"description"`
+			Status        string `json:"status"`
+			Notes         string `json:"notes"`
+		} `json:"info"`
+		Chart struct {
+			Metadata struct {
+				Name       string `json:"name"`
+				Version    string `json:"version"`
+				AppVersion string `json:"appVersion"`
+			} `json:"metadata"`
+		} `json:"chart"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &release); err != nil {
+		return nil, fmt.Errorf("parsing release status: %w", err)
+	}
+
+	return &ReleaseStatus{
+		Name:          release.Name,
+		Namespace:     release.Namespace,
+		Revision:      release.Version,
+		Status:        release.Info.Status,
+		Description:   release.Info.Description,
+		Chart:         release.Chart.Metadata.Name,
+		ChartVersion:  release.Chart.Metadata.Version,
+		AppVersion:    release.Chart.Metadata.AppVersion,
+		FirstDeployed: release.Info.FirstDeployed,
+		LastDeployed:  release.Info.LastDeployed,
+		Notes:         release.Info.Notes,
+	}, nil
+}
+
+// parseReleaseHistory parses the output of "helm history --output json".
+func parseReleaseHistory(output string) ([]ReleaseRevision, error) {
+	var history []struct {
+		Revision    int    `json:"revision"`
+		Updated     string `json:"updated"`
+		Status      string `json:"status"`
+		Chart       string `json:"chart"`
+		AppVersion  string `json:"app_version"`
+		Description string `json:"description"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &history); err != nil {
+		return nil, fmt.Errorf("parsing release history: %w", err)
+	}
+
+	revisions := make([]ReleaseRevision, 0, len(history))
+
+	for _, revision := range history {
+		revisions = append(revisions, ReleaseRevision{
+			Revision:    revision.Revision,
+			Updated:     revision.Updated,
+			Status:      revision.Status,
+			Chart:       revision.Chart,
+			AppVersion:  revision.AppVersion,
+			Description: revision.Description,
+		})
+	}
+
+	return revisions, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"dagger/helm/internal/dagger"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// repositoryConfigPath is the default location of the Helm repository configuration.
+const repositoryConfigPath = "/root/.config/helm/repositories.yaml"
+
+// A classic (HTTP) chart repository.
+type Repository struct {
+	// +private
+	Name string
+
+	// +private
+	URL string
+
+	// +private
+	Username string
+
+	// +private
+	Password *dagger.Secret
+}
+
+// Add a classic (HTTP) chart repository.
+//
+// Repositories are written to the Helm repository configuration (mounted as a secret), so that they can be used to resolve chart dependencies.
+// The repository index is only downloaded when it is needed.
+func (m *Helm) WithRepository(
+	ctx context.Context,
+
+	// Name of the repository (may be used as "@name" in chart dependencies).
+	name string,
+
+	// URL of the repository.
+	url string,
+
+	// Repository username.
+	//
+	// +optional
+	username string,
+
+	// Repository password.
+	//
+	// +optional
+	password *dagger.Secret,
+) (*Helm, error) {
+	m.Repositories = slices.DeleteFunc(slices.Clone(m.Repositories), func(r Repository) bool {
+		return r.Name == name
+	})
+
+	m.Repositories = append(m.Repositories, Repository{
+		Name:     name,
+		URL:      url,
+		Username: username,
+		Password: password,
+	})
+
+	type entry struct {
+		Name     string `json:"name"`
+		URL      string `json:"url"`
+		Username string `json:"username,omitempty"`
+		Password string `json:"password,omitempty"`
+	}
+
+	entries := make([]entry, 0, len(m.Repositories))
+
+	for _, repository := range m.Repositories {
+		e := entry{
+			Name:     repository.Name,
+			URL:      repository.URL,
+			Username: repository.Username,
+		}
+
+		if repository.Password != nil {
+			plaintext, err := repository.Password.Plaintext(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			e.Password = plaintext
+		}
+
+		entries = append(entries, e)
+	}
+
+	config, err := yaml.Marshal(map[string]any{
+		"apiVersion":   "",
+		"repositories": entries,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the secret name must not be derived from the plaintext credentials, but it must change when they change
+	h := sha1.New()
+
+	for _, repository := range m.Repositories {
+		var passwordID dagger.SecretID
+
+		if repository.Password != nil {
+			passwordID, err = repository.Password.ID(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		_, err = fmt.Fprintf(h, "%s %s %s %s\n", repository.Name, repository.URL, repository.Username, passwordID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	secret := dag.SetSecret(fmt.Sprintf("helm-repositories-%x", h.Sum(nil)), string(config))
+
+	m.Container = m.Container.WithMountedSecret(repositoryConfigPath, secret, dagger.ContainerWithMountedSecretOpts{
+		Mode: 0600,
+	})
+
+	return m, nil
+}
+
+// Rebuild the charts/ directory based on the Chart.lock file.
+//
+// Returns the chart with its dependencies vendored in the charts/ directory.
+//
+// +cache="session"
+func (c *Chart) DependencyBuild(
+	ctx context.Context,
+
+	// Do not refresh the local repository cache.
+	//
+	// +optional
+	skipRefresh bool,
+) (*Chart, error) {
+	return c.dependency(ctx, "build", skipRefresh)
+}
+
+// Update the charts/ directory based on the contents of Chart.yaml (and update Chart.lock).
+//
+// Returns the chart with its dependencies vendored in the charts/ directory.
+//
+// +cache="session"
+func (c *Chart) DependencyUpdate(
+	ctx context.Context,
+
+	// Do not refresh the local repository cache.
+	//
+	// +optional
+	skipRefresh bool,
+) (*Chart, error) {
+	return c.dependency(ctx, "update", skipRefresh)
+}
+
+func (c *Chart) dependency(ctx context.Context, command string, skipRefresh bool) (*Chart, error) {
+	chartMetadata, err := getChartMetadata(ctx, c.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	chartPath := filepath.Join("/work/chart", chartMetadata.Name)
+
+	args := []string{"helm", "dependency", command, chartPath}
+
+	container := c.Helm.container().
+		WithMountedDirectory(chartPath, c.Directory)
+
+	if skipRefresh {
+		args = append(args, "--skip-refresh")
+	} else {
+		// The repository indexes are fetched on every run
+		container = container.WithEnvVariable("CACHE_BUSTER", time.Now().Format(time.RFC3339Nano))
+	}
+
+	dir := container.
+		WithExec(args).
+		Directory(chartPath)
+
+	return &Chart{
+		Directory: dir,
+		Helm:      c.Helm,
+	}, nil
+}
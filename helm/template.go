@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"dagger/helm/internal/dagger"
+	"fmt"
+	"maps"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Kubernetes manifests rendered from a Helm chart.
+type Manifests struct {
+	// Rendered manifests as a single multi-document YAML file.
+	File *dagger.File
+
+	// Rendered manifests split per resource.
+	//
+	// Resources are named after their kind, API group and name (e.g., "deployment.apps-foo.yaml" or "service-foo.yaml" for the core group).
+	// Namespaced resources (with an explicit namespace) are placed in a directory named after the namespace.
+	// Resources rendered more than once get a numeric suffix (e.g., "service-foo-2.yaml").
+	Directory *dagger.Directory
+}
+
+// Render chart templates locally (without a cluster).
+func (c *Chart) Template(
+	ctx context.Context,
+
+	// Helm release name.
+	//
+	// +optional
+	// +default="release-name"
+	releaseName string,
+
+	// Namespace scope for this request.
+	//
+	// +optional
+	namespace string,
+
+	// Specify values in a YAML file.
+	//
+	// +optional
+	values []*dagger.File,
+
+	// Set values (e.g., "image.tag=latest").
+	//
+	// +optional
+	set []string,
+
+	// Kubernetes version used for Capabilities.KubeVersion.
+	//
+	// +optional
+	kubeVersion string,
+
+	// Kubernetes api versions used for Capabilities.APIVersions.
+	//
+	// +optional
+	apiVersions []string,
+
+	// Only show manifests rendered from the given templates (e.g., "templates/deployment.yaml").
+	//
+	// +optional
+	showOnly []string,
+) (*Manifests, error) {
+	const manifestsPath = "/work/manifests.yaml"
+
+	chartMetadata, err := getChartMetadata(ctx, c.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	if releaseName == "" {
+		releaseName = "release-name"
+	}
+
+	chartPath := filepath.Join("/work/chart", chartMetadata.Name)
+
+	container := c.Helm.container().
+		WithMountedDirectory(chartPath, c.Directory)
+
+	args := []string{"helm", "template", releaseName, chartPath}
+
+	for i, file := range values {
+		name, err := file.Name(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// values files may share the same name
+		valuesPath := filepath.Join("/work/values", strconv.Itoa(i), name)
+
+		container = container.WithMountedFile(valuesPath, file)
+		args = append(args, "--values", valuesPath)
+	}
+
+	for _, value := range set {
+		args = append(args, "--set", value)
+	}
+
+	if kubeVersion != "" {
+		args = append(args, "--kube-version", kubeVersion)
+	}
+
+	for _, apiVersion := range apiVersions {
+		args = append(args, "--api-versions", apiVersion)
+	}
+
+	for _, template := range showOnly {
+		args = append(args, "--show-only", template)
+	}
+
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+
+	file := container.
+		WithExec(args, dagger.ContainerWithExecOpts{
+			RedirectStdout: manifestsPath,
+		}).
+		File(manifestsPath)
+
+	contents, err := file.Contents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := splitManifests(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := dag.Directory()
+
+	for _, name := range slices.Sorted(maps.Keys(resources)) {
+		dir = dir.WithNewFile(name, resources[name])
+	}
+
+	return &Manifests{
+		File:      file,
+		Directory: dir,
+	}, nil
+}
+
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// splitManifests splits a multi-document YAML stream into resources keyed by their file name.
+func splitManifests(contents string) (map[string]string, error) {
+	resources := map[string]string{}
+
+	for _, document := range documentSeparator.Split(contents, -1) {
+		var resource struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+		}
+
+		if err := yaml.Unmarshal([]byte(document), &resource); err != nil {
+			return nil, fmt.Errorf("parsing rendered manifest: %w", err)
+		}
+
+		// templates rendering nothing still produce a document (containing only a "# Source" comment)
+		if resource.Kind == "" {
+			continue
+		}
+
+		if resource.Metadata.Name == "" {
+			return nil, fmt.Errorf("rendered %s has no name", resource.Kind)
+		}
+
+		// resources of the core group (apiVersion "v1") are named after their kind only
+		kind := strings.ToLower(resource.Kind)
+		if group, _, ok := strings.Cut(resource.APIVersion, "/"); ok {
+			kind += "." + group
+		}
+
+		base := path.Join(resource.Metadata.Namespace, kind+"-"+resource.Metadata.Name)
+
+		// the same resource may be rendered more than once (e.g., from different templates)
+		name := base + ".yaml"
+		for i := 2; ; i++ {
+			if _, ok := resources[name]; !ok {
+				break
+			}
+
+			name = base + "-" + strconv.Itoa(i) + ".yaml"
+		}
+
+		resources[name] = strings.TrimSpace(document) + "\n"
+	}
+
+	return resources, nil
+}
@@ -5,6 +5,7 @@ import (
 	"dagger/helm/tests/internal/dagger"
 	"fmt"
 	"slices"
+	"strings"
 
 	"github.com/sourcegraph/conc/pool"
 )
@@ -31,10 +32,16 @@ func (m *Tests) All(ctx context.Context) error {
 	p.Go(m.ChartLint)
 	p.Go(m.ChartPackage)
 	p.Go(m.ChartPublish)
+	p.Go(m.ChartTemplate)
+	p.Go(m.ChartUnitTest)
+	p.Go(m.ChartUnitTest_Failure)
+	p.Go(m.ChartUnitTest_Helm4)
+	p.Go(m.ChartDependencies)
 
 	p.Go(m.ChartInstall)
 	p.Go(m.PackageInstall)
 	p.Go(m.InstallNamespace)
+	p.Go(m.ReleaseLifecycle)
 
 	return p.Wait()
 }
@@ -144,6 +151,209 @@ func (m *Tests) ChartPublish(ctx context.Context) error {
 		})
 }
 
+func (m *Tests) ChartTemplate(ctx context.Context) error {
+	values := dag.Directory().
+		WithNewFile("values.yaml", "service:\n  port: 8080\n").
+		File("values.yaml")
+
+	// a resource of a different API group with the same kind and name as the chart service
+	chart := dag.CurrentModule().Source().Directory("./testdata/charts/package").
+		WithNewFile("templates/knative.yaml", `apiVersion: serving.knative.dev/v1
+kind: Service
+metadata:
+  name: {{ include "package.fullname" . }}
+`)
+
+	manifests := newHelm().
+		Chart(chart).
+		Template(dagger.HelmChartTemplateOpts{
+			ReleaseName: "foo",
+			Namespace:   "bar",
+			Values:      []*dagger.File{values},
+			Set:         []string{"serviceAccount.create=false"},
+		})
+
+	entries, err := manifests.Directory().Entries(ctx)
+	if err != nil {
+		return err
+	}
+
+	expected := []string{
+		"deployment.apps-foo-package.yaml",
+		"pod-foo-package-test-connection.yaml",
+		"service-foo-package.yaml",
+		"service.serving.knative.dev-foo-package.yaml",
+	}
+	if !slices.Equal(entries, expected) {
+		return fmt.Errorf("expected rendered resources to be %v, got %v", expected, entries)
+	}
+
+	service, err := manifests.Directory().File("service-foo-package.yaml").Contents(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(service, "port: 8080") {
+		return fmt.Errorf("expected service to use the port from the values file, got:\n%s", service)
+	}
+
+	all, err := manifests.File().Contents(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(all, "kind: Deployment") || !strings.Contains(all, "kind: Service") {
+		return fmt.Errorf("expected rendered manifests to contain every resource, got:\n%s", all)
+	}
+
+	return nil
+}
+
+const serviceTestSuite = `suite: service
+templates:
+  - service.yaml
+tests:
+  - it: exposes the configured port
+    asserts:
+      - equal:
+          path: spec.ports[0].port
+          value: 80
+`
+
+func (m *Tests) ChartUnitTest(ctx context.Context) error {
+	chart := dag.CurrentModule().Source().Directory("./testdata/charts/package").
+		WithNewFile("tests/service_test.yaml", serviceTestSuite)
+
+	report := newHelm().Chart(chart).UnitTest()
+
+	passed, err := report.Passed(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !passed {
+		output, err := report.Output(ctx)
+		if err != nil {
+			return err
+		}
+
+		return fmt.Errorf("expected unit tests to pass, got:\n%s", output)
+	}
+
+	junit, err := report.Report().Contents(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(junit, "exposes the configured port") {
+		return fmt.Errorf("expected JUnit report to contain the test case, got:\n%s", junit)
+	}
+
+	return nil
+}
+
+// Helm 4 verifies plugins on installation by default.
+func (m *Tests) ChartUnitTest_Helm4(ctx context.Context) error {
+	chart := dag.CurrentModule().Source().Directory("./testdata/charts/package").
+		WithNewFile("tests/service_test.yaml", serviceTestSuite)
+
+	return dag.Helm(dagger.HelmOpts{Version: "4.0.0"}).
+		Chart(chart).
+		UnitTest().
+		Check(ctx)
+}
+
+func (m *Tests) ChartUnitTest_Failure(ctx context.Context) error {
+	chart := dag.CurrentModule().Source().Directory("./testdata/charts/package").
+		WithNewFile("tests/service_test.yaml", serviceTestSuite)
+
+	values := dag.Directory().
+		WithNewFile("values.yaml", "service:\n  port: 8080\n").
+		File("values.yaml")
+
+	passed, err := newHelm().Chart(chart).UnitTest(dagger.HelmChartUnitTestOpts{
+		Values: []*dagger.File{values},
+	}).Passed(ctx)
+	if err != nil {
+		return err
+	}
+
+	if passed {
+		return fmt.Errorf("expected unit tests to fail with the overridden port")
+	}
+
+	return nil
+}
+
+func (m *Tests) ChartDependencies(ctx context.Context) error {
+	dependency := newHelm().Create("dep").Package().File()
+
+	repository := chartRepositoryService(dag.Directory().WithFile("dep-0.1.0.tgz", dependency))
+
+	password := dag.SetSecret("chart-repository-password", "password")
+
+	helm := dag.Helm(dagger.HelmOpts{
+		Container: newHelm().Container().WithServiceBinding("chartmuseum", repository),
+	}).
+		WithRepository("museum", "http://chartmuseum:8080", dagger.HelmWithRepositoryOpts{
+			Username: "username",
+			Password: password,
+		})
+
+	parent := helm.Create("parent").Directory()
+
+	chartYaml, err := parent.File("Chart.yaml").Contents(ctx)
+	if err != nil {
+		return err
+	}
+
+	parent = parent.WithNewFile("Chart.yaml", chartYaml+`
+dependencies:
+  - name: dep
+    version: 0.1.0
+    repository: "@museum"
+`)
+
+	updated := helm.Chart(parent).DependencyUpdate().Directory()
+
+	entries, err := updated.Entries(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(entries, "Chart.lock") {
+		return fmt.Errorf("expected dependency update to write Chart.lock, got %v", entries)
+	}
+
+	// rebuild dependencies from the lock file only
+	built := helm.Chart(updated.WithoutDirectory("charts")).DependencyBuild().Directory()
+
+	for _, dir := range []*dagger.Directory{updated, built} {
+		charts, err := dir.Entries(ctx, dagger.DirectoryEntriesOpts{Path: "charts"})
+		if err != nil {
+			return err
+		}
+
+		if !slices.Contains(charts, "dep-0.1.0.tgz") {
+			return fmt.Errorf("expected dependency to be vendored, got %v", charts)
+		}
+	}
+
+	return nil
+}
+
+func chartRepositoryService(charts *dagger.Directory) *dagger.Service {
+	return dag.Container().
+		From("ghcr.io/helm/chartmuseum:v0.16.2").
+		WithEnvVariable("STORAGE", "local").
+		WithEnvVariable("STORAGE_LOCAL_ROOTDIR", "/charts").
+		WithEnvVariable("BASIC_AUTH_USER", "username").
+		WithEnvVariable("BASIC_AUTH_PASS", "password").
+		WithMountedDirectory("/charts", charts).
+		WithExposedPort(8080).
+		AsService(dagger.ContainerAsServiceOpts{UseEntrypoint: true})
+}
+
 func registryService() *dagger.Service {
 	const zotRepositoryTemplate = "ghcr.io/project-zot/zot"
 	const zotVersion = "v2.1.1"
@@ -156,14 +366,14 @@ func registryService() *dagger.Service {
 }
 
 func (m *Tests) ChartInstall(ctx context.Context) error {
-	k8s := dag.K3S("daggerverse-helm-chart-install")
+	cluster := newHelm().Cluster("chart-install")
 
-	_, err := k8s.Server().Start(ctx)
+	_, err := cluster.Service().Start(ctx)
 	if err != nil {
 		return err
 	}
 
-	helm := newHelm().WithKubeconfigFile(k8s.Config(dagger.K3SConfigOpts{Local: false}))
+	helm := newHelm().WithCluster(cluster)
 
 	release := helm.Create("foo").Install("foo", dagger.HelmChartInstallOpts{
 		Wait: true,
@@ -180,14 +390,14 @@ func (m *Tests) ChartInstall(ctx context.Context) error {
 }
 
 func (m *Tests) PackageInstall(ctx context.Context) error {
-	k8s := dag.K3S("daggerverse-helm-package-install")
+	cluster := newHelm().Cluster("package-install")
 
-	_, err := k8s.Server().Start(ctx)
+	_, err := cluster.Service().Start(ctx)
 	if err != nil {
 		return err
 	}
 
-	helm := newHelm().WithKubeconfigFile(k8s.Config(dagger.K3SConfigOpts{Local: false}))
+	helm := newHelm().WithCluster(cluster)
 
 	release := helm.Create("foo").Package().Install("foo", dagger.HelmPackageInstallOpts{
 		Wait: true,
@@ -204,14 +414,14 @@ func (m *Tests) PackageInstall(ctx context.Context) error {
 }
 
 func (m *Tests) InstallNamespace(ctx context.Context) error {
-	k8s := dag.K3S("daggerverse-helm-install-namespace")
+	cluster := newHelm().Cluster("install-namespace")
 
-	_, err := k8s.Server().Start(ctx)
+	_, err := cluster.Service().Start(ctx)
 	if err != nil {
 		return err
 	}
 
-	helm := newHelm().WithKubeconfigFile(k8s.Config(dagger.K3SConfigOpts{Local: false}))
+	helm := newHelm().WithCluster(cluster)
 
 	release := helm.Create("foo").Install("foo", dagger.HelmChartInstallOpts{
 		CreateNamespace: true,
@@ -228,3 +438,104 @@ func (m *Tests) InstallNamespace(ctx context.Context) error {
 
 	return nil
 }
+
+func (m *Tests) ReleaseLifecycle(ctx context.Context) error {
+	cluster := newHelm().Cluster("release-lifecycle")
+
+	_, err := cluster.Service().Start(ctx)
+	if err != nil {
+		return err
+	}
+
+	helm := newHelm().WithCluster(cluster)
+
+	chart := helm.Create("foo")
+
+	// operations on a release handle are not repeated when the handle is reused
+	release := helm.Release("foo", dagger.HelmReleaseOpts{
+		Namespace: "lifecycle",
+	})
+
+	_, err = chart.Upgrade("foo", dagger.HelmChartUpgradeOpts{
+		Install:         true,
+		CreateNamespace: true,
+		Namespace:       "lifecycle",
+		Wait:            true,
+	}).Name(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = chart.Upgrade("foo", dagger.HelmChartUpgradeOpts{
+		Description: "second revision",
+		Namespace:   "lifecycle",
+		Wait:        true,
+	}).Name(ctx)
+	if err != nil {
+		return err
+	}
+
+	status := release.Status()
+
+	revision, err := status.Revision(ctx)
+	if err != nil {
+		return err
+	}
+
+	description, err := status.Description(ctx)
+	if err != nil {
+		return err
+	}
+
+	if revision != 2 || description != "second revision" {
+		return fmt.Errorf("expected revision 2 (second revision), got %d (%s)", revision, description)
+	}
+
+	_, err = release.Rollback(dagger.HelmReleaseRollbackOpts{
+		Revision: 1,
+		Wait:     true,
+	}).Name(ctx)
+	if err != nil {
+		return err
+	}
+
+	history, err := release.History(ctx)
+	if err != nil {
+		return err
+	}
+
+	var statuses []string
+
+	for _, revision := range history {
+		status, err := revision.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	expected := []string{"superseded", "superseded", "deployed"}
+	if !slices.Equal(statuses, expected) {
+		return fmt.Errorf("expected revision statuses to be %v, got %v", expected, statuses)
+	}
+
+	err = release.Uninstall(ctx, dagger.HelmReleaseUninstallOpts{
+		KeepHistory: true,
+		Wait:        true,
+	})
+	if err != nil {
+		return err
+	}
+
+	uninstalled, err := release.Status().Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	if uninstalled != "uninstalled" {
+		return fmt.Errorf("expected release to be uninstalled, got %s", uninstalled)
+	}
+
+	return nil
+}
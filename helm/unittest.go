@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"dagger/helm/internal/dagger"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// helmUnittestRepository is the repository of the helm-unittest plugin.
+const helmUnittestRepository = "https://github.com/helm-unittest/helm-unittest"
+
+// defaultHelmUnittestVersion is the default version of the helm-unittest plugin.
+const defaultHelmUnittestVersion = "v0.7.2"
+
+// Result of a chart unit test run.
+type UnitTestReport struct {
+	// Whether every test passed.
+	Passed bool
+
+	// Human readable output of the test run.
+	Output string
+
+	// Report in the requested output format (JUnit by default).
+	Report *dagger.File
+}
+
+// Return an error if the test run failed.
+func (r *UnitTestReport) Check() error {
+	if r.Passed {
+		return nil
+	}
+
+	return fmt.Errorf("chart unit tests failed:\n%s", r.Output)
+}
+
+// Run chart unit tests using the helm-unittest plugin (without a cluster).
+//
+// Test failures do not cause the function to fail: consult the returned report (or call Check on it) instead.
+func (c *Chart) UnitTest(
+	ctx context.Context,
+
+	// Glob of the test suite files (relative to the chart).
+	//
+	// +optional
+	// +default="tests/*_test.yaml"
+	testsGlob string,
+
+	// Values files overriding the chart values in every test suite.
+	//
+	// +optional
+	values []*dagger.File,
+
+	// Format of the report (JUnit, NUnit, XUnit or Sonar).
+	//
+	// +optional
+	// +default="JUnit"
+	outputFormat string,
+
+	// Version of the helm-unittest plugin to install.
+	//
+	// +optional
+	// +default="v0.7.2"
+	version string,
+) (*UnitTestReport, error) {
+	const reportPath = "/work/report.xml"
+
+	if testsGlob == "" {
+		testsGlob = "tests/*_test.yaml"
+	}
+
+	if outputFormat == "" {
+		outputFormat = "JUnit"
+	}
+
+	if version == "" {
+		version = defaultHelmUnittestVersion
+	}
+
+	chartMetadata, err := getChartMetadata(ctx, c.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	chartPath := filepath.Join("/work/chart", chartMetadata.Name)
+
+	container := c.Helm.container()
+
+	helmVersion, err := container.WithExec([]string{"helm", "version", "--template", "{{ .Version }}"}).Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	installArgs := []string{"helm", "plugin", "install", helmUnittestRepository, "--version", version}
+
+	// Helm 4 verifies plugins by default, but the plugin is installed from its source repository (without provenance)
+	if strings.HasPrefix(helmVersion, "v4.") {
+		installArgs = append(installArgs, "--verify=false")
+	}
+
+	container = container.
+		WithExec(installArgs).
+		WithMountedDirectory(chartPath, c.Directory)
+
+	args := []string{"helm", "unittest", "--file", testsGlob, "--output-type", outputFormat, "--output-file", reportPath}
+
+	for i, file := range values {
+		name, err := file.Name(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// values files may share the same name
+		valuesPath := filepath.Join("/work/values", strconv.Itoa(i), name)
+
+		container = container.WithMountedFile(valuesPath, file)
+		args = append(args, "--values", valuesPath)
+	}
+
+	args = append(args, chartPath)
+
+	container = container.WithExec(args, dagger.ContainerWithExecOpts{
+		Expect: dagger.ReturnTypeAny,
+	})
+
+	exitCode, err := container.ExitCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := container.Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the report is not written if the chart or the test suites cannot be loaded
+	report, err := container.File(reportPath).Sync(ctx)
+	if err != nil {
+		stderr, serr := container.Stderr(ctx)
+		if serr != nil {
+			return nil, serr
+		}
+
+		return nil, fmt.Errorf("helm unittest exited with code %d:\n%s%s", exitCode, output, stderr)
+	}
+
+	return &UnitTestReport{
+		Passed: exitCode == 0,
+		Output: output,
+		Report: report,
+	}, nil
+}
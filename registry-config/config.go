@@ -10,11 +10,126 @@ import (
 )
 
 type Config struct {
-	Auths map[string]ConfigAuth `json:"auths"`
+	Auths       map[string]ConfigAuth `json:"auths"`
+	CredHelpers map[string]string     `json:"credHelpers,omitempty"`
+	CredsStore  string                `json:"credsStore,omitempty"`
+
+	// Unknown fields of merged configuration files (eg. HttpHeaders or proxies) are preserved as is.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type ConfigAuth struct {
-	Auth string `json:"auth"`
+	Auth          string `json:"auth,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+	RegistryToken string `json:"registrytoken,omitempty"`
+}
+
+// Known top-level keys of the configuration file.
+var configKeys = []string{"auths", "credHelpers", "credsStore"}
+
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type config Config
+
+	var known config
+
+	if err := json.Unmarshal(data, &known); err != nil {
+		return err
+	}
+
+	var extra map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return err
+	}
+
+	for _, key := range configKeys {
+		delete(extra, key)
+	}
+
+	*c = Config(known)
+	c.Extra = extra
+
+	return nil
+}
+
+func (c Config) MarshalJSON() ([]byte, error) {
+	type config Config
+
+	out, err := json.Marshal(config(c))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.Extra) == 0 {
+		return out, nil
+	}
+
+	fields := map[string]json.RawMessage{}
+
+	for key, value := range c.Extra {
+		fields[key] = value
+	}
+
+	var known map[string]json.RawMessage
+
+	if err := json.Unmarshal(out, &known); err != nil {
+		return nil, err
+	}
+
+	for key, value := range known {
+		fields[key] = value
+	}
+
+	return json.Marshal(fields)
+}
+
+// merge merges another configuration into the current one.
+//
+// Entries in the other configuration take precedence.
+// A registry address is either configured using credentials or a credential helper, so an entry for an address replaces both.
+func (c *Config) merge(other *Config) {
+	for key, value := range other.Extra {
+		if c.Extra == nil {
+			c.Extra = map[string]json.RawMessage{}
+		}
+
+		c.Extra[key] = value
+	}
+
+	for address, auth := range other.Auths {
+		c.setAuth(address, auth)
+	}
+
+	for address, helper := range other.CredHelpers {
+		c.setCredHelper(address, helper)
+	}
+
+	if other.CredsStore != "" {
+		c.CredsStore = other.CredsStore
+	}
+}
+
+func (c *Config) setAuth(address string, auth ConfigAuth) {
+	delete(c.CredHelpers, address)
+
+	c.Auths[address] = auth
+}
+
+func (c *Config) setCredHelper(address string, helper string) {
+	delete(c.Auths, address)
+
+	if c.CredHelpers == nil {
+		c.CredHelpers = map[string]string{}
+	}
+
+	c.CredHelpers[address] = helper
+}
+
+func (c *Config) remove(address string) {
+	delete(c.Auths, address)
+	delete(c.CredHelpers, address)
 }
 
 func (m *RegistryConfig) toConfig(ctx context.Context) (*Config, error) {
@@ -22,15 +137,55 @@ func (m *RegistryConfig) toConfig(ctx context.Context) (*Config, error) {
 		Auths: map[string]ConfigAuth{},
 	}
 
+	for _, secret := range m.Configs {
+		plaintext, err := secret.Plaintext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var base Config
+
+		if err := json.Unmarshal([]byte(plaintext), &base); err != nil {
+			return nil, fmt.Errorf("parsing registry configuration: %w", err)
+		}
+
+		config.merge(&base)
+	}
+
+	for _, address := range m.Removed {
+		config.remove(address)
+	}
+
 	for _, auth := range m.Auths {
+		if auth.IdentityToken != nil {
+			token, err := auth.IdentityToken.Plaintext(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			config.setAuth(auth.Address, ConfigAuth{
+				IdentityToken: token,
+			})
+
+			continue
+		}
+
 		plaintext, err := auth.Secret.Plaintext(ctx)
 		if err != nil {
 			return nil, err
 		}
 
-		config.Auths[auth.Address] = ConfigAuth{
+		config.setAuth(auth.Address, ConfigAuth{
 			Auth: base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", auth.Username, plaintext))),
-		}
+		})
+	}
+
+	for _, helper := range m.CredHelpers {
+		config.setCredHelper(helper.Address, helper.Helper)
+	}
+
+	if m.CredsStore != "" {
+		config.CredsStore = m.CredsStore
 	}
 
 	return config, nil
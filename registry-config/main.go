@@ -21,18 +21,39 @@ import (
 type RegistryConfig struct {
 	// +private
 	Auths []Auth
+
+	// +private
+	CredHelpers []CredHelper
+
+	// +private
+	CredsStore string
+
+	// +private
+	Configs []*dagger.Secret
+
+	// +private
+	Removed []string
 }
 
 type Auth struct {
 	Address  string
 	Username string
 	Secret   *dagger.Secret
+
+	IdentityToken *dagger.Secret
+}
+
+type CredHelper struct {
+	Address string
+	Helper  string
 }
 
 // Add credentials for a registry.
 //
 // +cache="session"
 func (m *RegistryConfig) WithRegistryAuth(address string, username string, secret *dagger.Secret) *RegistryConfig {
+	m.withoutCredHelper(address)
+
 	m.Auths = append(m.Auths, Auth{
 		Address:  address,
 		Username: username,
@@ -42,15 +63,88 @@ func (m *RegistryConfig) WithRegistryAuth(address string, username string, secre
 	return m
 }
 
+// Add an identity token (eg. an OAuth2 refresh token) for a registry.
+//
+// +cache="session"
+func (m *RegistryConfig) WithIdentityToken(address string, token *dagger.Secret) *RegistryConfig {
+	m.withoutCredHelper(address)
+
+	m.Auths = append(m.Auths, Auth{
+		Address:       address,
+		IdentityToken: token,
+	})
+
+	return m
+}
+
+// Use a credential helper (eg. ecr-login) for a registry.
+//
+// The helper binary (docker-credential-<helper>) needs to be available in the container using the configuration.
+//
+// +cache="session"
+func (m *RegistryConfig) WithCredentialHelper(address string, helper string) *RegistryConfig {
+	m.withoutAuth(address)
+	m.withoutCredHelper(address)
+
+	m.CredHelpers = append(m.CredHelpers, CredHelper{
+		Address: address,
+		Helper:  helper,
+	})
+
+	return m
+}
+
+// Use a credential store (eg. pass or secretservice) for registries without explicit credentials.
+//
+// +cache="session"
+func (m *RegistryConfig) WithCredentialStore(store string) *RegistryConfig {
+	m.CredsStore = store
+
+	return m
+}
+
+// Merge an existing configuration file (eg. ~/.docker/config.json) into the registry configuration.
+//
+// Configuration files are merged in the order they are added (entries in later files take precedence).
+// Credentials and credential helpers added explicitly always take precedence over merged configuration files.
+//
+// Unknown fields of the configuration file (eg. HttpHeaders) are preserved.
+//
+// +cache="session"
+func (m *RegistryConfig) WithConfig(config *dagger.Secret) *RegistryConfig {
+	m.Configs = append(m.Configs, config)
+
+	return m
+}
+
 // Removes credentials for a registry.
 //
 // +cache="session"
 func (m *RegistryConfig) WithoutRegistryAuth(address string) *RegistryConfig {
+	m.withoutAuth(address)
+	m.withoutCredHelper(address)
+
+	if !slices.Contains(m.Removed, address) {
+		m.Removed = append(m.Removed, address)
+	}
+
+	return m
+}
+
+func (m *RegistryConfig) withoutAuth(address string) {
 	m.Auths = slices.DeleteFunc(m.Auths, func(a Auth) bool {
 		return a.Address == address
 	})
+}
 
-	return m
+func (m *RegistryConfig) withoutCredHelper(address string) {
+	m.CredHelpers = slices.DeleteFunc(m.CredHelpers, func(h CredHelper) bool {
+		return h.Address == address
+	})
+}
+
+func (m *RegistryConfig) isEmpty() bool {
+	return len(m.Auths) == 0 && len(m.CredHelpers) == 0 && m.CredsStore == "" && len(m.Configs) == 0
 }
 
 // Create the registry configuration.
@@ -141,7 +235,7 @@ type SecretMount struct {
 
 // +cache="session"
 func (m *SecretMount) Mount(ctx context.Context, container *dagger.Container) (*dagger.Container, error) {
-	if m.SkipOnEmpty && len(m.RegistryConfig.Auths) == 0 {
+	if m.SkipOnEmpty && m.RegistryConfig.isEmpty() {
 		return container, nil
 	}
 
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"dagger/registry-config/tests/internal/dagger"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/sourcegraph/conc/pool"
 )
@@ -17,6 +19,14 @@ func (m *Tests) All(ctx context.Context) error {
 	p.Go(m.WithRegistryAuth)
 	p.Go(m.WithRegistryAuth_MultipleCredentials)
 	p.Go(m.WithoutRegistryAuth)
+	p.Go(m.WithIdentityToken)
+	p.Go(m.WithCredentialHelper)
+	p.Go(m.WithConfig)
+	p.Go(m.WithConfig_Multiple)
+	p.Go(m.WithConfig_Conflicts)
+	p.Go(m.WithConfig_WithoutRegistryAuth)
+	p.Go(m.Verify)
+	p.Go(m.Verify_InvalidCredentials)
 	p.Go(m.SecretMount)
 	p.Go(m.SecretMount_SkipOnEmpty)
 
@@ -86,6 +96,257 @@ func (m *Tests) WithoutRegistryAuth(ctx context.Context) error {
 	return nil
 }
 
+func (m *Tests) WithIdentityToken(ctx context.Context) error {
+	secret := dag.RegistryConfig().
+		WithRegistryAuth("ghcr.io", "sagikazarmark", dag.SetSecret("WithIdentityToken-password", "password")).
+		WithIdentityToken("ghcr.io", dag.SetSecret("WithIdentityToken-token", "token")).
+		WithRegistryAuth("docker.io", "sagikazarmark", dag.SetSecret("WithIdentityToken-password2", "password2")).
+		Secret()
+
+	actual, err := secret.Plaintext(ctx)
+	if err != nil {
+		return err
+	}
+
+	const expected = `{"auths":{"docker.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZDI="},"ghcr.io":{"identitytoken":"token"}}}`
+
+	if actual != expected {
+		return fmt.Errorf("secret does not match the expected value\nactual:   %s\nexpected: %s", actual, expected)
+	}
+
+	return nil
+}
+
+func (m *Tests) WithCredentialHelper(ctx context.Context) error {
+	secret := dag.RegistryConfig().
+		WithRegistryAuth("ghcr.io", "sagikazarmark", dag.SetSecret("WithCredentialHelper-password", "password")).
+		WithRegistryAuth("docker.io", "sagikazarmark", dag.SetSecret("WithCredentialHelper-password2", "password2")).
+		WithCredentialHelper("ghcr.io", "gh").
+		WithCredentialHelper("public.ecr.aws", "ecr-login").
+		WithCredentialStore("pass").
+		Secret()
+
+	actual, err := secret.Plaintext(ctx)
+	if err != nil {
+		return err
+	}
+
+	const expected = `{"auths":{"docker.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZDI="}},"credHelpers":{"ghcr.io":"gh","public.ecr.aws":"ecr-login"},"credsStore":"pass"}`
+
+	if actual != expected {
+		return fmt.Errorf("secret does not match the expected value\nactual:   %s\nexpected: %s", actual, expected)
+	}
+
+	return nil
+}
+
+func (m *Tests) WithConfig(ctx context.Context) error {
+	const config = `{"auths":{"ghcr.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZA=="}},"credHelpers":{"public.ecr.aws":"ecr-login"},"HttpHeaders":{"User-Agent":"Dagger"}}`
+
+	secret := dag.RegistryConfig().
+		WithConfig(dag.SetSecret("WithConfig-config", config)).
+		WithRegistryAuth("docker.io", "sagikazarmark", dag.SetSecret("WithConfig-password2", "password2")).
+		Secret()
+
+	actual, err := secret.Plaintext(ctx)
+	if err != nil {
+		return err
+	}
+
+	const expected = `{"HttpHeaders":{"User-Agent":"Dagger"},"auths":{"docker.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZDI="},"ghcr.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZA=="}},"credHelpers":{"public.ecr.aws":"ecr-login"}}`
+
+	if actual != expected {
+		return fmt.Errorf("secret does not match the expected value\nactual:   %s\nexpected: %s", actual, expected)
+	}
+
+	return nil
+}
+
+func (m *Tests) WithConfig_Multiple(ctx context.Context) error {
+	const config1 = `{"auths":{"ghcr.io":{"auth":"b2xkOm9sZA=="},"docker.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZDI="}},"credsStore":"pass"}`
+	const config2 = `{"auths":{"ghcr.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZA=="}},"credHelpers":{"docker.io":"desktop"}}`
+
+	secret := dag.RegistryConfig().
+		WithConfig(dag.SetSecret("WithConfig_Multiple-config1", config1)).
+		WithConfig(dag.SetSecret("WithConfig_Multiple-config2", config2)).
+		Secret()
+
+	actual, err := secret.Plaintext(ctx)
+	if err != nil {
+		return err
+	}
+
+	const expected = `{"auths":{"ghcr.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZA=="}},"credHelpers":{"docker.io":"desktop"},"credsStore":"pass"}`
+
+	if actual != expected {
+		return fmt.Errorf("secret does not match the expected value\nactual:   %s\nexpected: %s", actual, expected)
+	}
+
+	return nil
+}
+
+func (m *Tests) WithConfig_Conflicts(ctx context.Context) error {
+	const config = `{"auths":{"ghcr.io":{"auth":"b2xkOm9sZA=="},"gcr.io":{"auth":"b2xkOm9sZA=="}},"credHelpers":{"docker.io":"desktop"},"credsStore":"pass"}`
+
+	// Explicit settings take precedence over the merged configuration regardless of the order they are added in.
+	secret := dag.RegistryConfig().
+		WithRegistryAuth("docker.io", "sagikazarmark", dag.SetSecret("WithConfig_Conflicts-password2", "password2")).
+		WithConfig(dag.SetSecret("WithConfig_Conflicts-config", config)).
+		WithRegistryAuth("ghcr.io", "sagikazarmark", dag.SetSecret("WithConfig_Conflicts-password", "password")).
+		WithCredentialHelper("gcr.io", "gcloud").
+		WithCredentialStore("secretservice").
+		Secret()
+
+	actual, err := secret.Plaintext(ctx)
+	if err != nil {
+		return err
+	}
+
+	const expected = `{"auths":{"docker.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZDI="},"ghcr.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZA=="}},"credHelpers":{"gcr.io":"gcloud"},"credsStore":"secretservice"}`
+
+	if actual != expected {
+		return fmt.Errorf("secret does not match the expected value\nactual:   %s\nexpected: %s", actual, expected)
+	}
+
+	return nil
+}
+
+func (m *Tests) WithConfig_WithoutRegistryAuth(ctx context.Context) error {
+	const config = `{"auths":{"ghcr.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZA=="},"gcr.io":{"auth":"b2xkOm9sZA=="}},"credHelpers":{"public.ecr.aws":"ecr-login"}}`
+
+	secret := dag.RegistryConfig().
+		WithConfig(dag.SetSecret("WithConfig_WithoutRegistryAuth-config", config)).
+		WithoutRegistryAuth("gcr.io").
+		WithoutRegistryAuth("public.ecr.aws").
+		Secret()
+
+	actual, err := secret.Plaintext(ctx)
+	if err != nil {
+		return err
+	}
+
+	const expected = `{"auths":{"ghcr.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZA=="}}}`
+
+	if actual != expected {
+		return fmt.Errorf("secret does not match the expected value\nactual:   %s\nexpected: %s", actual, expected)
+	}
+
+	return nil
+}
+
+func (m *Tests) Verify(ctx context.Context) error {
+	registry, err := startRegistry(ctx, "Verify")
+	if err != nil {
+		return err
+	}
+	defer registry.Stop(ctx)
+
+	endpoint, err := registry.Endpoint(ctx)
+	if err != nil {
+		return err
+	}
+
+	statuses, err := dag.RegistryConfig().
+		WithRegistryAuth(endpoint, "sagikazarmark", dag.SetSecret("Verify-password", "password")).
+		Verify(ctx, dagger.RegistryConfigVerifyOpts{
+			PlainHTTP: []string{endpoint},
+			Strict:    true,
+		})
+	if err != nil {
+		return err
+	}
+
+	if len(statuses) != 1 {
+		return fmt.Errorf("expected 1 status, got %d", len(statuses))
+	}
+
+	valid, err := statuses[0].Valid(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !valid {
+		return errors.New("expected credentials to be valid")
+	}
+
+	scheme, err := statuses[0].Scheme(ctx)
+	if err != nil {
+		return err
+	}
+
+	if scheme != "basic" {
+		return fmt.Errorf("expected basic authentication scheme, got %q", scheme)
+	}
+
+	return nil
+}
+
+func (m *Tests) Verify_InvalidCredentials(ctx context.Context) error {
+	registry, err := startRegistry(ctx, "Verify_InvalidCredentials")
+	if err != nil {
+		return err
+	}
+	defer registry.Stop(ctx)
+
+	endpoint, err := registry.Endpoint(ctx)
+	if err != nil {
+		return err
+	}
+
+	registryConfig := dag.RegistryConfig().
+		WithRegistryAuth(endpoint, "sagikazarmark", dag.SetSecret("Verify_InvalidCredentials-password", "invalid"))
+
+	statuses, err := registryConfig.Verify(ctx, dagger.RegistryConfigVerifyOpts{
+		PlainHTTP: []string{endpoint},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(statuses) != 1 {
+		return fmt.Errorf("expected 1 status, got %d", len(statuses))
+	}
+
+	valid, err := statuses[0].Valid(ctx)
+	if err != nil {
+		return err
+	}
+
+	if valid {
+		return errors.New("expected credentials to be invalid")
+	}
+
+	_, err = registryConfig.Verify(ctx, dagger.RegistryConfigVerifyOpts{
+		PlainHTTP: []string{endpoint},
+		Strict:    true,
+	})
+	if err == nil {
+		return errors.New("expected strict verification to fail")
+	}
+
+	if !strings.Contains(err.Error(), endpoint) {
+		return fmt.Errorf("expected error to report %s, got %q", endpoint, err)
+	}
+
+	return nil
+}
+
+// startRegistry starts a registry accepting sagikazarmark:password as credentials.
+func startRegistry(ctx context.Context, name string) (*dagger.Service, error) {
+	htpasswd, err := dag.Container().
+		From("alpine").
+		WithExec([]string{"apk", "add", "apache2-utils"}).
+		WithExec([]string{"htpasswd", "-Bbn", "sagikazarmark", "password"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return dag.Registry(dagger.RegistryOpts{
+		Htpasswd: dag.SetSecret(name+"-htpasswd", htpasswd),
+	}).Service().Start(ctx)
+}
+
 func (m *Tests) SecretMount(ctx context.Context) error {
 	const expected = `{"auths":{"docker.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZDI="},"ghcr.io":{"auth":"c2FnaWthemFybWFyazpwYXNzd29yZA=="}}}`
 
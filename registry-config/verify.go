@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Result of verifying credentials against a registry.
+type RegistryStatus struct {
+	// Address of the registry as it appears in the configuration.
+	Address string
+
+	// Whether the registry accepted the credentials.
+	Valid bool
+
+	// Authentication scheme offered by the registry (basic, bearer or none).
+	Scheme string
+
+	// Reason of the failure (if any).
+	Error string
+}
+
+// Verify credentials against the configured registries.
+//
+// The function performs the registry (v2) authentication handshake (basic or token) for each registry with credentials or an identity token.
+// Registries configured to use a credential helper are not verified.
+//
+// +cache="session"
+func (m *RegistryConfig) Verify(
+	ctx context.Context,
+
+	// Registries to reach over plain HTTP (eg. a local registry without TLS).
+	//
+	// +optional
+	plainHttp []string,
+
+	// Skip TLS certificate verification.
+	//
+	// +optional
+	insecure bool,
+
+	// Return an error if any of the registries rejects the credentials.
+	//
+	// Every registry is verified regardless: the error lists each rejected registry (along with the reason).
+	//
+	// +optional
+	strict bool,
+) ([]RegistryStatus, error) {
+	config, err := m.toConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: insecure,
+			},
+		},
+	}
+
+	addresses := make([]string, 0, len(config.Auths))
+	for address := range config.Auths {
+		addresses = append(addresses, address)
+	}
+
+	slices.Sort(addresses)
+
+	statuses := make([]RegistryStatus, 0, len(addresses))
+
+	var errs []error
+
+	for _, address := range addresses {
+		v := verifier{
+			client:    client,
+			address:   address,
+			plainHttp: slices.Contains(plainHttp, address),
+			auth:      config.Auths[address],
+		}
+
+		status := v.verify(ctx)
+		if strict && !status.Valid {
+			errs = append(errs, fmt.Errorf("%s: %s", address, status.Error))
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	// the statuses are returned along with the error, so that none of them is lost
+	if err := errors.Join(errs...); err != nil {
+		return statuses, fmt.Errorf("verifying registry credentials: %w", err)
+	}
+
+	return statuses, nil
+}
+
+type verifier struct {
+	client    *http.Client
+	address   string
+	plainHttp bool
+	auth      ConfigAuth
+}
+
+func (v verifier) verify(ctx context.Context) RegistryStatus {
+	status := RegistryStatus{
+		Address: v.address,
+	}
+
+	scheme, err := v.handshake(ctx)
+	status.Scheme = scheme
+
+	if err != nil {
+		status.Error = err.Error()
+
+		return status
+	}
+
+	status.Valid = true
+
+	return status
+}
+
+func (v verifier) handshake(ctx context.Context) (string, error) {
+	username, password, err := v.credentials()
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := v.endpoint()
+
+	resp, err := v.do(ctx, http.MethodGet, endpoint, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return "none", nil
+
+	case http.StatusUnauthorized:
+		// continue with the authentication challenge
+
+	default:
+		return "", fmt.Errorf("unexpected status code from %s: %d", endpoint, resp.StatusCode)
+	}
+
+	scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+
+	switch scheme {
+	case "basic":
+		if username == "" {
+			return scheme, errors.New("registry requires basic authentication, but no username and password is configured")
+		}
+
+		resp, err := v.do(ctx, http.MethodGet, endpoint, func(req *http.Request) {
+			req.SetBasicAuth(username, password)
+		}, nil)
+		if err != nil {
+			return scheme, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return scheme, fmt.Errorf("registry rejected the credentials: %d", resp.StatusCode)
+		}
+
+		return scheme, nil
+
+	case "bearer":
+		token, err := v.token(ctx, params, username, password)
+		if err != nil {
+			return scheme, err
+		}
+
+		resp, err := v.do(ctx, http.MethodGet, endpoint, func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}, nil)
+		if err != nil {
+			return scheme, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return scheme, fmt.Errorf("registry rejected the token: %d", resp.StatusCode)
+		}
+
+		return scheme, nil
+
+	default:
+		return scheme, fmt.Errorf("unsupported authentication scheme: %q", scheme)
+	}
+}
+
+// token requests a token from the authorization server (https://distribution.github.io/distribution/spec/auth/token/).
+func (v verifier) token(ctx context.Context, params map[string]string, username string, password string) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", errors.New("missing realm in authentication challenge")
+	}
+
+	var resp *response
+	var err error
+
+	if v.auth.IdentityToken != "" {
+		// https://distribution.github.io/distribution/spec/auth/oauth/
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {v.auth.IdentityToken},
+			"service":       {params["service"]},
+			"client_id":     {"dagger"},
+		}
+
+		resp, err = v.do(ctx, http.MethodPost, realm, func(req *http.Request) {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}, strings.NewReader(form.Encode()))
+	} else {
+		u, perr := url.Parse(realm)
+		if perr != nil {
+			return "", fmt.Errorf("parsing realm: %w", perr)
+		}
+
+		query := u.Query()
+
+		if service := params["service"]; service != "" {
+			query.Set("service", service)
+		}
+
+		if username != "" {
+			query.Set("account", username)
+		}
+
+		u.RawQuery = query.Encode()
+
+		resp, err = v.do(ctx, http.MethodGet, u.String(), func(req *http.Request) {
+			if username != "" {
+				req.SetBasicAuth(username, password)
+			}
+		}, nil)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("authorization server rejected the credentials: %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.Unmarshal(resp.body, &body); err != nil {
+		return "", fmt.Errorf("parsing token response: %w", err)
+	}
+
+	if body.Token != "" {
+		return body.Token, nil
+	}
+
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+
+	return "", errors.New("authorization server returned an empty token")
+}
+
+type response struct {
+	*http.Response
+
+	body []byte
+}
+
+func (v verifier) do(ctx context.Context, method string, u string, modify func(req *http.Request), body io.Reader) (*response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if modify != nil {
+		modify(req)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response{
+		Response: resp,
+		body:     b,
+	}, nil
+}
+
+func (v verifier) credentials() (string, string, error) {
+	if v.auth.IdentityToken != "" {
+		return "", "", nil
+	}
+
+	if v.auth.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(v.auth.Auth)
+		if err != nil {
+			return "", "", fmt.Errorf("decoding credentials: %w", err)
+		}
+
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return "", "", errors.New("invalid credentials: expected username:password")
+		}
+
+		return username, password, nil
+	}
+
+	return v.auth.Username, v.auth.Password, nil
+}
+
+// endpoint returns the base (/v2/) endpoint of the registry.
+func (v verifier) endpoint() string {
+	host := v.address
+
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		host = u.Host
+	} else {
+		host, _, _ = strings.Cut(host, "/")
+	}
+
+	switch host {
+	case "docker.io", "index.docker.io":
+		host = "registry-1.docker.io"
+	}
+
+	scheme := "https"
+	if v.plainHttp {
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%s://%s/v2/", scheme, host)
+}
+
+// parseChallenge parses a WWW-Authenticate header (eg. Bearer realm="https://auth.docker.io/token",service="registry.docker.io").
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := map[string]string{}
+
+	for rest != "" {
+		var param string
+
+		rest = strings.TrimLeft(rest, " ,")
+
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				param, rest = value[1:], ""
+			} else {
+				param, rest = value[1:end+1], value[end+2:]
+			}
+		} else {
+			param, rest, _ = strings.Cut(value, ",")
+		}
+
+		params[strings.ToLower(strings.TrimSpace(key))] = param
+	}
+
+	return strings.ToLower(scheme), params
+}
@@ -40,6 +40,11 @@ func New(
 	//
 	// +optional
 	dataVolume *dagger.CacheVolume,
+
+	// Enable basic authentication using an htpasswd file (passwords must be hashed using bcrypt).
+	//
+	// +optional
+	htpasswd *dagger.Secret,
 ) (*Registry, error) {
 	if container == nil {
 		if version == "" {
@@ -63,6 +68,17 @@ func New(
 					WithMountedCache("/var/lib/registry", dataVolume)
 			}
 
+			return c
+		}).
+		With(func(c *dagger.Container) *dagger.Container {
+			if htpasswd != nil {
+				c = c.
+					WithEnvVariable("REGISTRY_AUTH", "htpasswd").
+					WithEnvVariable("REGISTRY_AUTH_HTPASSWD_REALM", "Registry Realm").
+					WithEnvVariable("REGISTRY_AUTH_HTPASSWD_PATH", "/auth/htpasswd").
+					WithMountedSecret("/auth/htpasswd", htpasswd)
+			}
+
 			return c
 		})
 
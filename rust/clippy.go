@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"dagger/rust/internal/dagger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+type Clippy struct {
+	// +private
+	Rust *Rust
+
+	// +private
+	Pkg string
+
+	// +private
+	Features []string
+
+	// +private
+	AllFeatures bool
+
+	// +private
+	NoDefaultFeatures bool
+
+	// +private
+	Release bool
+
+	// +private
+	Profile string
+
+	// +private
+	Target string
+
+	// +private
+	Allow []string
+
+	// +private
+	Warn []string
+
+	// +private
+	Deny []string
+
+	// +private
+	DenyWarnings bool
+}
+
+// Checks a package to catch common mistakes and improve your Rust code.
+func (m *Rust) Clippy(
+	// Lints to allow (e.g., "clippy::needless_return").
+	//
+	// +optional
+	allow []string,
+
+	// Lints to warn about (e.g., "clippy::pedantic").
+	//
+	// +optional
+	warn []string,
+
+	// Lints to deny (e.g., "clippy::unwrap_used").
+	//
+	// +optional
+	deny []string,
+
+	// Treat all warnings as errors (-D warnings).
+	//
+	// +optional
+	denyWarnings bool,
+
+	// Package Selection
+
+	// Package to check.
+	//
+	// +optional
+	pkg string,
+
+	// Feature Selection
+
+	// List of features to activate.
+	//
+	// +optional
+	features []string,
+
+	// Activate all available features.
+	//
+	// +optional
+	allFeatures bool,
+
+	// Do not activate the `default` feature.
+	//
+	// +optional
+	noDefaultFeatures bool,
+
+	// Compilation options
+
+	// Check artifacts in release mode, with optimizations.
+	//
+	// +optional
+	release bool,
+
+	// Check artifacts with the specified profile.
+	//
+	// +optional
+	profile string,
+
+	// Check for the target triple.
+	//
+	// +optional
+	target string,
+) *Clippy {
+	return &Clippy{
+		Rust:              m,
+		Pkg:               pkg,
+		Features:          features,
+		AllFeatures:       allFeatures,
+		NoDefaultFeatures: noDefaultFeatures,
+		Release:           release,
+		Profile:           profile,
+		Target:            target,
+		Allow:             allow,
+		Warn:              warn,
+		Deny:              deny,
+		DenyWarnings:      denyWarnings,
+	}
+}
+
+func (m *Clippy) builtin() cargoBuiltin {
+	return cargoBuiltin{
+		pkg:               m.Pkg,
+		features:          m.Features,
+		allFeatures:       m.AllFeatures,
+		noDefaultFeatures: m.NoDefaultFeatures,
+		release:           m.Release,
+		profile:           m.Profile,
+		target:            m.Target,
+	}
+}
+
+// lintArgs returns the lint level arguments passed to clippy (after "--").
+func (m *Clippy) lintArgs() []string {
+	var args []string
+
+	for _, lint := range m.Allow {
+		args = append(args, "-A", lint)
+	}
+
+	for _, lint := range m.Warn {
+		args = append(args, "-W", lint)
+	}
+
+	for _, lint := range m.Deny {
+		args = append(args, "-D", lint)
+	}
+
+	if m.DenyWarnings {
+		args = append(args, "-D", "warnings")
+	}
+
+	return args
+}
+
+func (m *Clippy) args(noDeps bool, extra ...string) []string {
+	args := append(m.Rust.cargo(), "clippy")
+	args = append(args, m.builtin().args()...)
+
+	if noDeps {
+		args = append(args, "--no-deps")
+	}
+
+	args = append(args, extra...)
+
+	if lintArgs := m.lintArgs(); len(lintArgs) > 0 {
+		args = append(args, "--")
+		args = append(args, lintArgs...)
+	}
+
+	return args
+}
+
+// Run checks.
+func (m *Clippy) Run(
+	// Run Clippy only on the given crate, without linting the dependencies.
+	//
+	// +optional
+	noDeps bool,
+) *dagger.Container {
+	return m.Rust.container().WithExec(m.args(noDeps))
+}
+
+// Fix checks.
+func (m *Clippy) Fix() *dagger.Changeset {
+	// changes are returned as a changeset, so there is nothing to lose
+	args := m.args(false, "--fix", "--allow-no-vcs", "--allow-dirty", "--allow-staged")
+
+	return m.Rust.container().WithExec(args).Directory(".").Changes(m.Rust.Source)
+}
+
+// Run checks and collect the reported diagnostics.
+//
+// Lint failures do not cause the function to fail: consult the returned report (or call Check on it) instead.
+func (m *Clippy) Diagnostics(
+	ctx context.Context,
+
+	// Run Clippy only on the given crate, without linting the dependencies.
+	//
+	// +optional
+	noDeps bool,
+) (*ClippyReport, error) {
+	args := m.args(noDeps, "--message-format", "json")
+
+	container := m.Rust.container().WithExec(args, dagger.ContainerWithExecOpts{
+		Expect: dagger.ReturnTypeAny,
+	})
+
+	exitCode, err := container.ExitCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := container.Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics, err := parseClippyOutput(stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	// clippy exits with a non-zero code without reporting an error if it fails to run (e.g., invalid flags)
+	if exitCode != 0 && !slices.ContainsFunc(diagnostics, func(d Diagnostic) bool { return d.Level == "error" }) {
+		stderr, err := container.Stderr(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("cargo clippy exited with code %d:\n%s", exitCode, stderr)
+	}
+
+	return &ClippyReport{
+		Passed:      exitCode == 0,
+		Diagnostics: diagnostics,
+	}, nil
+}
+
+// Diagnostics reported by Clippy.
+type ClippyReport struct {
+	// Whether Clippy reported no errors.
+	Passed bool
+
+	// Reported diagnostics.
+	Diagnostics []Diagnostic
+}
+
+// A diagnostic reported by the compiler or Clippy.
+type Diagnostic struct {
+	// Level of the diagnostic (error, warning, note or help).
+	Level string
+
+	// Lint that triggered the diagnostic (e.g., "clippy::needless_return").
+	//
+	// Empty for compiler errors without a code.
+	Lint string
+
+	// Description of the diagnostic.
+	Message string
+
+	// Path of the file (relative to the source directory).
+	File string
+
+	// Line where the diagnostic starts.
+	Line int
+
+	// Column where the diagnostic starts.
+	Column int
+
+	// Line where the diagnostic ends.
+	EndLine int
+
+	// Column where the diagnostic ends.
+	EndColumn int
+
+	// Diagnostic rendered by the compiler.
+	Rendered string
+}
+
+// Return an error if Clippy reported errors.
+func (r *ClippyReport) Check() error {
+	if r.Passed {
+		return nil
+	}
+
+	var b strings.Builder
+
+	for _, diagnostic := range r.Diagnostics {
+		if diagnostic.Level != "error" {
+			continue
+		}
+
+		b.WriteString(diagnostic.Rendered)
+	}
+
+	return fmt.Errorf("clippy failed:\n%s", b.String())
+}
+
+// parseClippyOutput parses the output of "cargo clippy --message-format json".
+func parseClippyOutput(output string) ([]Diagnostic, error) {
+	type span struct {
+		FileName    string `json:"file_name"`
+		LineStart   int    `json:"line_start"`
+		LineEnd     int    `json:"line_end"`
+		ColumnStart int    `json:"column_start"`
+		ColumnEnd   int    `json:"column_end"`
+		IsPrimary   bool   `json:"is_primary"`
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(output))
+
+	var diagnostics []Diagnostic
+
+	seen := map[Diagnostic]bool{}
+
+	for {
+		var message struct {
+			Reason  string `json:"reason"`
+			Message struct {
+				Message string `json:"message"`
+				Level   string `json:"level"`
+				Code    *struct {
+					Code string `json:"code"`
+				} `json:"code"`
+				Spans    []span `json:"spans"`
+				Rendered string `json:"rendered"`
+			} `json:"message"`
+		}
+
+		err := decoder.Decode(&message)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parsing clippy output: %w", err)
+		}
+
+		if message.Reason != "compiler-message" {
+			continue
+		}
+
+		// summaries (e.g., "N warnings emitted") have no location
+		i := slices.IndexFunc(message.Message.Spans, func(s span) bool { return s.IsPrimary })
+		if i < 0 {
+			continue
+		}
+
+		primary := message.Message.Spans[i]
+
+		diagnostic := Diagnostic{
+			Level:     message.Message.Level,
+			Message:   message.Message.Message,
+			File:      primary.FileName,
+			Line:      primary.LineStart,
+			Column:    primary.ColumnStart,
+			EndLine:   primary.LineEnd,
+			EndColumn: primary.ColumnEnd,
+			Rendered:  message.Message.Rendered,
+		}
+
+		if message.Message.Code != nil {
+			diagnostic.Lint = message.Message.Code.Code
+		}
+
+		// the same diagnostic is reported for every target (e.g., lib and bin) a file belongs to
+		if seen[diagnostic] {
+			continue
+		}
+
+		seen[diagnostic] = true
+		diagnostics = append(diagnostics, diagnostic)
+	}
+
+	return diagnostics, nil
+}
+
+// Export diagnostics in SARIF format (e.g., for GitHub code scanning).
+func (r *ClippyReport) Sarif() (*dagger.File, error) {
+	type region struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn"`
+		EndLine     int `json:"endLine"`
+		EndColumn   int `json:"endColumn"`
+	}
+
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region region `json:"region"`
+		} `json:"physicalLocation"`
+	}
+
+	type message struct {
+		Text string `json:"text"`
+	}
+
+	type result struct {
+		RuleID    string     `json:"ruleId,omitempty"`
+		Level     string     `json:"level"`
+		Message   message    `json:"message"`
+		Locations []location `json:"locations"`
+	}
+
+	type rule struct {
+		ID      string `json:"id"`
+		HelpURI string `json:"helpUri,omitempty"`
+	}
+
+	results := make([]result, 0, len(r.Diagnostics))
+	rules := []rule{}
+
+	for _, diagnostic := range r.Diagnostics {
+		// SARIF has no help level
+		level := diagnostic.Level
+		if level != "error" && level != "warning" {
+			level = "note"
+		}
+
+		loc := location{}
+		loc.PhysicalLocation.ArtifactLocation.URI = diagnostic.File
+		loc.PhysicalLocation.Region = region{
+			StartLine:   diagnostic.Line,
+			StartColumn: diagnostic.Column,
+			EndLine:     diagnostic.EndLine,
+			EndColumn:   diagnostic.EndColumn,
+		}
+
+		results = append(results, result{
+			RuleID:    diagnostic.Lint,
+			Level:     level,
+			Message:   message{Text: diagnostic.Message},
+			Locations: []location{loc},
+		})
+
+		if diagnostic.Lint == "" || slices.ContainsFunc(rules, func(r rule) bool { return r.ID == diagnostic.Lint }) {
+			continue
+		}
+
+		rule := rule{ID: diagnostic.Lint}
+
+		if name, ok := strings.CutPrefix(diagnostic.Lint, "clippy::"); ok {
+			rule.HelpURI = "https://rust-lang.github.io/rust-clippy/master/index.html#" + name
+		}
+
+		rules = append(rules, rule)
+	}
+
+	sarif := map[string]any{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []any{
+			map[string]any{
+				"tool": map[string]any{
+					"driver": map[string]any{
+						"name":           "clippy",
+						"informationUri": "https://github.com/rust-lang/rust-clippy",
+						"rules":          rules,
+					},
+				},
+				"results": results,
+			},
+		},
+	}
+
+	content, err := json.MarshalIndent(sarif, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return dag.Directory().WithNewFile("clippy.sarif", string(content)).File("clippy.sarif"), nil
+}
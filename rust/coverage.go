@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"dagger/rust/internal/dagger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Code coverage collected by a test run.
+type CoverageReport struct {
+	// Coverage report (in lcov, cobertura or JSON format).
+	//
+	// Empty when the format is html.
+	File *dagger.File
+
+	// Coverage report in HTML format.
+	//
+	// Empty unless the format is html.
+	Directory *dagger.Directory
+
+	// Total line coverage percentage.
+	Lines float64
+}
+
+// Run tests and collect code coverage using cargo-llvm-cov.
+func (m *Rust) Coverage(
+	ctx context.Context,
+
+	// Format of the coverage report (lcov, cobertura, json or html).
+	//
+	// +optional
+	// +default="lcov"
+	format string,
+
+	// Version of cargo-llvm-cov to install.
+	//
+	// +optional
+	version string,
+
+	// Package Selection
+
+	// Package to build.
+	//
+	// +optional
+	pkg string,
+
+	// Feature Selection
+
+	// List of features to activate.
+	//
+	// +optional
+	features []string,
+
+	// Activate all available features.
+	//
+	// +optional
+	allFeatures bool,
+
+	// Do not activate the `default` feature.
+	//
+	// +optional
+	noDefaultFeatures bool,
+
+	// Compilation options
+
+	// Build artifacts in release mode, with optimizations.
+	//
+	// +optional
+	release bool,
+
+	// Build artifacts with the specified profile.
+	//
+	// +optional
+	profile string,
+) (*CoverageReport, error) {
+	const outputPath = "/work/coverage"
+
+	if format == "" {
+		format = "lcov"
+	}
+
+	formats := map[string]string{
+		"lcov":      "lcov.info",
+		"cobertura": "cobertura.xml",
+		"json":      "coverage.json",
+		"html":      "",
+	}
+
+	fileName, ok := formats[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported coverage format %q (supported: lcov, cobertura, json, html)", format)
+	}
+
+	pkgName := "cargo-llvm-cov"
+	if version != "" {
+		pkgName += "@" + version
+	}
+
+	r := *m
+	r.Components = slices.Clone(m.Components)
+	r.withComponent("llvm-tools-preview")
+
+	builtin := cargoBuiltin{
+		pkg:               pkg,
+		features:          features,
+		allFeatures:       allFeatures,
+		noDefaultFeatures: noDefaultFeatures,
+		release:           release,
+		profile:           profile,
+	}
+
+	// reports are generated from the same build artifacts
+	reportBuiltin := cargoBuiltin{
+		release: release,
+		profile: profile,
+	}
+
+	args := []string{"cargo", "llvm-cov", "--locked", "--no-report"}
+	args = append(args, builtin.args()...)
+
+	container := r.Container.
+		WithExec([]string{"cargo", "install", "--locked", pkgName}).
+		WithMountedDirectory(".", r.Source).
+		WithExec(args)
+
+	summaryArgs := []string{"cargo", "llvm-cov", "report", "--json", "--summary-only"}
+	summaryArgs = append(summaryArgs, reportBuiltin.args()...)
+
+	summary, err := container.WithExec(summaryArgs).Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := parseCoverageSummary(summary)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CoverageReport{
+		Lines: lines,
+	}
+
+	reportArgs := []string{"cargo", "llvm-cov", "report", "--" + format}
+
+	if format == "html" {
+		reportArgs = append(reportArgs, "--output-dir", outputPath)
+		reportArgs = append(reportArgs, reportBuiltin.args()...)
+
+		report.Directory = container.WithExec(reportArgs).Directory(outputPath + "/html")
+	} else {
+		reportArgs = append(reportArgs, "--output-path", outputPath+"/"+fileName)
+		reportArgs = append(reportArgs, reportBuiltin.args()...)
+
+		report.File = container.WithExec(reportArgs).File(outputPath + "/" + fileName)
+	}
+
+	return report, nil
+}
+
+// parseCoverageSummary parses the total line coverage from the output of "cargo llvm-cov report --json --summary-only".
+func parseCoverageSummary(output string) (float64, error) {
+	var summary struct {
+		Data []struct {
+			Totals struct {
+				Lines struct {
+					Percent float64 `json:"percent"`
+				} `json:"lines"`
+			} `json:"totals"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &summary); err != nil {
+		return 0, fmt.Errorf("parsing coverage summary: %w", err)
+	}
+
+	if len(summary.Data) == 0 {
+		return 0, errors.New("coverage summary contains no data")
+	}
+
+	return summary.Data[0].Totals.Lines.Percent, nil
+}
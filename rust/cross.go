@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"dagger/rust/internal/dagger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultZigVersion is the version of Zig used as a linker for cross-compilation.
+const defaultZigVersion = "0.13.0"
+
+// Add a target to cross-compile to using cargo-zigbuild (Zig as a linker).
+//
+// Builds for cross targets use "cargo zigbuild" instead of "cargo build",
+// so that binaries can be linked for other architectures, libc implementations (e.g., musl) and operating systems (e.g., Windows).
+func (m *Rust) WithCrossTarget(
+	// Target triple (e.g., "aarch64-unknown-linux-musl", "x86_64-pc-windows-gnu").
+	triple string,
+
+	// Version of Zig to install.
+	//
+	// +optional
+	// +default="0.13.0"
+	zigVersion string,
+
+	// Version of cargo-zigbuild to install.
+	//
+	// +optional
+	zigbuildVersion string,
+) *Rust {
+	if slices.Contains(m.CrossTargets, triple) {
+		return m
+	}
+
+	if len(m.CrossTargets) == 0 {
+		m.Container = m.withZigbuild(zigVersion, zigbuildVersion)
+	}
+
+	m.CrossTargets = append(m.CrossTargets, triple)
+	m.Container = m.Container.WithExec([]string{"rustup", "target", "add", triple})
+
+	return m
+}
+
+func (m *Rust) withZigbuild(zigVersion string, zigbuildVersion string) *dagger.Container {
+	if zigVersion == "" {
+		zigVersion = defaultZigVersion
+	}
+
+	pkg := "cargo-zigbuild"
+	if zigbuildVersion != "" {
+		pkg += "@" + zigbuildVersion
+	}
+
+	script := strings.Join([]string{
+		"mkdir -p /opt/zig",
+		fmt.Sprintf("curl -fsSL https://ziglang.org/download/%[1]s/zig-linux-$(uname -m)-%[1]s.tar.xz | tar -xJ -C /opt/zig --strip-components=1", zigVersion),
+		"ln -s /opt/zig/zig /usr/local/bin/zig",
+	}, " && ")
+
+	return m.Container.
+		WithExec([]string{"sh", "-c", script}).
+		WithExec([]string{"cargo", "install", "--locked", pkg})
+}
+
+// isCrossTarget reports whether builds for a target use cargo-zigbuild.
+func (m *Rust) isCrossTarget(target string) bool {
+	return target != "" && slices.Contains(m.CrossTargets, target)
+}
+
+// buildCommand returns the cargo command used to build for a target.
+func (m *Rust) buildCommand(target string) []string {
+	if m.isCrossTarget(target) {
+		return []string{"cargo", "zigbuild", "--locked"}
+	}
+
+	return append(m.cargo(), "build")
+}
+
+// Compile binaries for multiple targets in parallel.
+//
+// Every target is added as a cross target (see WithCrossTarget).
+// The resulting directory contains the binaries for each target in a directory named after the target triple
+// (e.g., "aarch64-unknown-linux-musl/app", "x86_64-pc-windows-gnu/app.exe").
+func (m *Rust) BuildMatrix(
+	ctx context.Context,
+
+	// Target triples to build for (e.g., "aarch64-unknown-linux-musl", "x86_64-pc-windows-gnu").
+	targets []string,
+
+	// Package Selection
+
+	// Package to build.
+	//
+	// +optional
+	pkg string,
+
+	// Feature Selection
+
+	// List of features to activate.
+	//
+	// +optional
+	features []string,
+
+	// Activate all available features.
+	//
+	// +optional
+	allFeatures bool,
+
+	// Do not activate the `default` feature.
+	//
+	// +optional
+	noDefaultFeatures bool,
+
+	// Compilation options
+
+	// Build artifacts in release mode, with optimizations.
+	//
+	// +optional
+	release bool,
+
+	// Build artifacts with the specified profile.
+	//
+	// +optional
+	profile string,
+) (*dagger.Directory, error) {
+	const outputPath = "/work/build.json"
+
+	if len(targets) == 0 {
+		return nil, errors.New("at least one target is required")
+	}
+
+	r := *m
+	r.CrossTargets = slices.Clone(m.CrossTargets)
+
+	for _, target := range targets {
+		r.WithCrossTarget(target, "", "")
+	}
+
+	binaries := make([][]*dagger.File, len(targets))
+	names := make([][]string, len(targets))
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	for i, target := range targets {
+		g.Go(func() error {
+			builtin := cargoBuiltin{
+				pkg:               pkg,
+				features:          features,
+				allFeatures:       allFeatures,
+				noDefaultFeatures: noDefaultFeatures,
+				release:           release,
+				profile:           profile,
+				target:            target,
+			}
+
+			args := r.buildCommand(target)
+			args = append(args, builtin.args()...)
+			args = append(args, "--message-format", "json-render-diagnostics")
+
+			container := r.cooked(builtin).
+				WithExec(args, dagger.ContainerWithExecOpts{
+					RedirectStdout: outputPath,
+				})
+
+			output, err := container.File(outputPath).Contents(ctx)
+			if err != nil {
+				return fmt.Errorf("building for %s: %w", target, err)
+			}
+
+			executables, err := parseExecutables(output)
+			if err != nil {
+				return err
+			}
+
+			for _, executable := range executables {
+				// skip executables built for the host (e.g., build scripts)
+				if !strings.Contains(executable, "/"+target+"/") {
+					continue
+				}
+
+				binaries[i] = append(binaries[i], container.File(executable))
+				names[i] = append(names[i], path.Join(target, path.Base(executable)))
+			}
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	dir := dag.Directory()
+
+	for i := range targets {
+		for j, binary := range binaries[i] {
+			dir = dir.WithFile(names[i][j], binary)
+		}
+	}
+
+	return dir, nil
+}
+
+// parseExecutables returns the paths of the executables built by cargo (from the output of "--message-format json").
+func parseExecutables(output string) ([]string, error) {
+	decoder := json.NewDecoder(strings.NewReader(output))
+
+	var executables []string
+
+	for {
+		var message struct {
+			Reason     string  `json:"reason"`
+			Executable *string `json:"executable"`
+		}
+
+		err := decoder.Decode(&message)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parsing cargo output: %w", err)
+		}
+
+		if message.Reason == "compiler-artifact" && message.Executable != nil {
+			executables = append(executables, *message.Executable)
+		}
+	}
+
+	return executables, nil
+}
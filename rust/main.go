@@ -5,6 +5,7 @@ import (
 	"context"
 	"dagger/rust/internal/dagger"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/pelletier/go-toml/v2"
@@ -13,11 +14,31 @@ import (
 // defaultImageRepository is used when no image is specified.
 const defaultImageRepository = "rust"
 
+// chefTargetDir is the target directory used when dependencies are prebuilt by cargo-chef.
+//
+// It is outside of the source directory, so that the prebuilt dependencies are not shadowed when the source is mounted.
+const chefTargetDir = "/work/target"
+
 type Rust struct {
 	Source *dagger.Directory
 
 	// +private
 	Container *dagger.Container
+
+	// Recipe prepared by cargo-chef (if enabled).
+	//
+	// +private
+	Recipe *dagger.File
+
+	// Installed components.
+	//
+	// +private
+	Components []string
+
+	// Targets built using cargo-zigbuild.
+	//
+	// +private
+	CrossTargets []string
 }
 
 func New(
@@ -107,12 +128,6 @@ func New(
 	// 	container = container.WithExec([]string{"rustup", "override", "set", toolchain.Channel})
 	// }
 
-	if components = append(components, toolchain.Components...); len(components) > 0 {
-		for _, component := range components {
-			container = container.WithExec([]string{"rustup", "component", "add", component})
-		}
-	}
-
 	if targets = append(targets, toolchain.Targets...); len(targets) > 0 {
 		for _, target := range targets {
 			container = container.WithExec([]string{"rustup", "target", "add", target})
@@ -126,6 +141,10 @@ func New(
 		Container: container,
 	}
 
+	for _, component := range append(components, toolchain.Components...) {
+		m = m.withComponent(component)
+	}
+
 	if !disableCache {
 		m = m.
 			WithRegistryCache(dag.CacheVolume("rust-registry"), nil, "").
@@ -162,6 +181,19 @@ func (m *Rust) WithRegistryCache(
 	return m
 }
 
+// Establish a runtime dependency on a service.
+func (m *Rust) WithServiceBinding(
+	// A name that can be used to reach the service from the container.
+	alias string,
+
+	// Identifier of the service container.
+	service *dagger.Service,
+) *Rust {
+	m.Container = m.Container.WithServiceBinding(alias, service)
+
+	return m
+}
+
 // Mount a cache volume for Cargo git cache.
 func (m *Rust) WithGitCache(
 	cache *dagger.CacheVolume,
@@ -188,11 +220,58 @@ func (m *Rust) WithGitCache(
 	return m
 }
 
+// withComponent installs a toolchain component (unless it is already installed).
+func (m *Rust) withComponent(component string) *Rust {
+	if slices.Contains(m.Components, component) {
+		return m
+	}
+
+	m.Components = append(m.Components, component)
+	m.Container = m.Container.WithExec([]string{"rustup", "component", "add", component})
+
+	return m
+}
+
 func (m *Rust) container() *dagger.Container {
 	return m.Container.WithMountedDirectory(".", m.Source)
 }
 
-// Mount a cache volume for Cargo registry cache.
+// cooked returns a container with the dependencies prebuilt by cargo-chef (if enabled) using the same options as the cargo command.
+//
+// Additional arguments select what to prebuild dependencies for (e.g., "--tests", "--check").
+func (m *Rust) cooked(builtin cargoBuiltin, args ...string) *dagger.Container {
+	if m.Recipe == nil {
+		return m.container()
+	}
+
+	cook := []string{"cargo", "chef", "cook", "--locked", "--recipe-path", "/work/recipe.json"}
+	cook = append(cook, builtin.args()...)
+	cook = append(cook, args...)
+
+	if m.isCrossTarget(builtin.target) {
+		cook = append(cook, "--zigbuild")
+	}
+
+	// the recipe is the only input (besides the options), so the layer is cached until the dependencies change
+	return m.Container.
+		WithMountedFile("/work/recipe.json", m.Recipe).
+		WithExec(cook).
+		WithMountedDirectory(".", m.Source)
+}
+
+// targetDir returns the directory build artifacts are written to.
+func (m *Rust) targetDir() string {
+	if m.Recipe != nil {
+		return chefTargetDir
+	}
+
+	return "./target"
+}
+
+// Prebuild dependencies using cargo-chef.
+//
+// Dependencies are built in a separate layer (cached until the dependencies change)
+// with the same options (package, features, profile and target) as the build, test or check command.
 func (m *Rust) WithChef(
 	// Version of cargo-chef to install.
 	//
@@ -204,15 +283,14 @@ func (m *Rust) WithChef(
 		pkg += "@" + version
 	}
 
-	recipe := m.Container.
-		WithExec([]string{"cargo", "install", pkg}).
-		WithMountedDirectory(".", m.Source).
-		WithExec([]string{"cargo", "chef", "prepare"}).
-		File("recipe.json")
-
 	m.Container = m.Container.
-		WithMountedFile("/work/recipe.json", recipe).
-		WithExec([]string{"cargo", "chef", "prepare", "--recipe-path", "/work/recipe.json"})
+		WithExec([]string{"cargo", "install", "--locked", pkg}).
+		WithEnvVariable("CARGO_TARGET_DIR", chefTargetDir)
+
+	m.Recipe = m.Container.
+		WithMountedDirectory(".", m.Source).
+		WithExec([]string{"cargo", "chef", "prepare", "--recipe-path", "/work/recipe.json"}).
+		File("/work/recipe.json")
 
 	return m
 }
@@ -343,7 +421,7 @@ func (m *Rust) Build(
 	// +optional
 	target string,
 ) *dagger.Directory {
-	args := append(m.cargo(), "build")
+	args := m.buildCommand(target)
 
 	builtin := cargoBuiltin{
 		pkg:               pkg,
@@ -352,11 +430,12 @@ func (m *Rust) Build(
 		noDefaultFeatures: noDefaultFeatures,
 		release:           release,
 		profile:           profile,
+		target:            target,
 	}
 
 	args = append(args, builtin.args()...)
 
-	return m.container().WithExec(args).Directory("./target")
+	return m.cooked(builtin).WithExec(args).Directory(m.targetDir())
 }
 
 // Execute all unit and integration tests and build examples of a local package.
@@ -429,6 +508,7 @@ func (m *Rust) Test(
 		noDefaultFeatures: noDefaultFeatures,
 		release:           release,
 		profile:           profile,
+		target:            target,
 	}
 
 	args = append(args, builtin.args()...)
@@ -438,7 +518,7 @@ func (m *Rust) Test(
 		args = append(args, rawArgs...)
 	}
 
-	return m.container().WithExec(args)
+	return m.cooked(builtin, "--tests").WithExec(args)
 }
 
 func (m *Rust) Check(
@@ -479,6 +559,11 @@ func (m *Rust) Check(
 	//
 	// +optional
 	profile string,
+
+	// Check for the target triple.
+	//
+	// +optional
+	target string,
 ) *dagger.Container {
 	args := append(m.cargo(), "check")
 
@@ -489,11 +574,12 @@ func (m *Rust) Check(
 		noDefaultFeatures: noDefaultFeatures,
 		release:           release,
 		profile:           profile,
+		target:            target,
 	}
 
 	args = append(args, builtin.args()...)
 
-	return m.container().WithExec(args)
+	return m.cooked(builtin, "--check").WithExec(args)
 }
 
 type Format struct {
@@ -550,38 +636,3 @@ func (m *Format) Check() *dagger.Container {
 
 	return m.Rust.container().WithExec(args)
 }
-
-type Clippy struct {
-	// +private
-	Rust *Rust
-}
-
-// Checks a package to catch common mistakes and improve your Rust code.
-func (m *Rust) Clippy() *Clippy {
-	return &Clippy{
-		Rust: m,
-	}
-}
-
-// Run checks.
-func (m *Clippy) Run(
-	// Run Clippy only on the given crate, without linting the dependencies.
-	//
-	// +optional
-	noDeps bool,
-) *dagger.Container {
-	args := append(m.Rust.cargo(), "clippy")
-
-	if noDeps {
-		args = append(args, "--no-deps")
-	}
-
-	return m.Rust.container().WithExec(args)
-}
-
-// Fix checks.
-func (m *Clippy) Fix() *dagger.Changeset {
-	args := append(m.Rust.cargo(), "clippy", "--fix")
-
-	return m.Rust.container().WithExec(args).Directory(".").Changes(m.Rust.Source)
-}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"dagger/rust/internal/dagger"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// nextestProfile is the nextest profile used to generate JUnit reports.
+//
+// Custom profiles inherit from the default profile, so the configuration in the repository still applies.
+// The profile is appended to the configuration of the repository (TOML does not allow redefining a table),
+// so its name is unlikely to clash with a profile defined by the repository.
+const nextestProfile = "dagger-rust-module-junit"
+
+const nextestConfigPath = "/work/nextest.toml"
+
+const nextestConfig = `
+[profile.` + nextestProfile + `.junit]
+path = "junit.xml"
+store-success-output = false
+store-failure-output = true
+`
+
+type Nextest struct {
+	// +private
+	Rust *Rust
+}
+
+// Run tests using cargo-nextest.
+func (m *Rust) Nextest(
+	// Version of cargo-nextest to install.
+	//
+	// +optional
+	version string,
+) *Nextest {
+	pkg := "cargo-nextest"
+	if version != "" {
+		pkg += "@" + version
+	}
+
+	r := *m
+	r.Container = r.Container.WithExec([]string{"cargo", "install", "--locked", pkg})
+
+	return &Nextest{
+		Rust: &r,
+	}
+}
+
+// Build and run tests.
+//
+// Test failures do not cause the function to fail: consult the returned report (or call Check on it) instead.
+func (m *Nextest) Run(
+	ctx context.Context,
+
+	// Only run tests matching these names (substring match).
+	//
+	// +optional
+	filters []string,
+
+	// Test filterset expression (e.g., "package(foo) & test(/^bar/)").
+	//
+	// +optional
+	expression string,
+
+	// Run a shard of the tests (e.g., "count:1/3" or "hash:1/3").
+	//
+	// +optional
+	partition string,
+
+	// Number of retries for failing tests.
+	//
+	// +optional
+	retries int,
+
+	// Package Selection
+
+	// Package to build.
+	//
+	// +optional
+	pkg string,
+
+	// Feature Selection
+
+	// List of features to activate.
+	//
+	// +optional
+	features []string,
+
+	// Activate all available features.
+	//
+	// +optional
+	allFeatures bool,
+
+	// Do not activate the `default` feature.
+	//
+	// +optional
+	noDefaultFeatures bool,
+
+	// Compilation options
+
+	// Build artifacts in release mode, with optimizations.
+	//
+	// +optional
+	release bool,
+
+	// Build artifacts with the specified profile.
+	//
+	// +optional
+	profile string,
+
+	// Build for the target triple.
+	//
+	// +optional
+	target string,
+) (*TestReport, error) {
+	builtin := cargoBuiltin{
+		pkg:               pkg,
+		features:          features,
+		allFeatures:       allFeatures,
+		noDefaultFeatures: noDefaultFeatures,
+		release:           release,
+		profile:           profile,
+		target:            target,
+	}
+
+	// nextest uses --profile for its own profiles
+	runBuiltin := builtin
+	runBuiltin.profile = ""
+
+	args := []string{"cargo", "nextest", "run", "--locked", "--no-fail-fast", "--config-file", nextestConfigPath, "--profile", nextestProfile}
+	args = append(args, runBuiltin.args()...)
+
+	if profile != "" {
+		args = append(args, "--cargo-profile", profile)
+	}
+
+	if expression != "" {
+		args = append(args, "-E", expression)
+	}
+
+	if partition != "" {
+		// shards may legitimately be empty
+		args = append(args, "--partition", partition, "--no-tests", "warn")
+	}
+
+	if retries > 0 {
+		args = append(args, "--retries", strconv.Itoa(retries))
+	}
+
+	if len(filters) > 0 {
+		args = append(args, "--")
+		args = append(args, filters...)
+	}
+
+	container := m.Rust.cooked(builtin, "--tests")
+
+	// the configuration of the repository (if any) is extended with the profile generating JUnit reports
+	config, err := m.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	junitPath := path.Join(m.Rust.targetDir(), "nextest", nextestProfile, "junit.xml")
+
+	container = container.
+		WithNewFile(nextestConfigPath, config).
+		WithExec(args, dagger.ContainerWithExecOpts{
+			Expect: dagger.ReturnTypeAny,
+		})
+
+	exitCode, err := container.ExitCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	junit := container.File(junitPath)
+
+	contents, err := junit.Contents(ctx)
+	if err != nil {
+		stderr, serr := container.Stderr(ctx)
+		if serr != nil {
+			return nil, serr
+		}
+
+		return nil, fmt.Errorf("cargo nextest exited with code %d:\n%s", exitCode, stderr)
+	}
+
+	report, err := parseJUnit(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	// nextest exits with a non-zero code without reporting a test failure if the build fails
+	if exitCode != 0 && report.Passed {
+		stderr, err := container.Stderr(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("cargo nextest exited with code %d:\n%s", exitCode, stderr)
+	}
+
+	report.Passed = report.Passed && exitCode == 0
+	report.Junit = junit
+
+	return report, nil
+}
+
+func (m *Nextest) config(ctx context.Context) (string, error) {
+	const repositoryConfig = ".config/nextest.toml"
+
+	exists, err := m.Rust.Source.Exists(ctx, repositoryConfig)
+	if err != nil {
+		return "", err
+	}
+
+	if !exists {
+		return nextestConfig, nil
+	}
+
+	config, err := m.Rust.Source.File(repositoryConfig).Contents(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.Contains(config, "profile."+nextestProfile) {
+		return "", fmt.Errorf("%s defines the reserved nextest profile %q", repositoryConfig, nextestProfile)
+	}
+
+	return config + "\n" + nextestConfig, nil
+}
+
+// Result of a test run.
+type TestReport struct {
+	// Whether every test passed.
+	Passed bool
+
+	// Results of the individual tests.
+	Tests []TestCase
+
+	// Report in JUnit XML format.
+	Junit *dagger.File
+}
+
+// Result of an individual test.
+type TestCase struct {
+	// Name of the test binary (e.g., "my-crate::bin/my-crate").
+	Suite string
+
+	// Name of the test (e.g., "tests::it_works").
+	Name string
+
+	// Outcome of the test (pass, fail, flaky or skip).
+	Status string
+
+	// Time it took to run the test (in seconds).
+	Duration float64
+
+	// Output of the test (if it failed).
+	Output string
+}
+
+// Return an error if the test run failed.
+func (r *TestReport) Check() error {
+	if r.Passed {
+		return nil
+	}
+
+	var errs []error
+
+	for _, test := range r.Tests {
+		if test.Status != "fail" {
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("--- FAIL: %s %s\n%s", test.Suite, test.Name, test.Output))
+	}
+
+	return fmt.Errorf("tests failed:\n%w", errors.Join(errs...))
+}
+
+type junitResult struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name          string        `xml:"name,attr"`
+	Time          string        `xml:"time,attr"`
+	Failure       *junitResult  `xml:"failure"`
+	Error         *junitResult  `xml:"error"`
+	Skipped       *junitResult  `xml:"skipped"`
+	FlakyFailures []junitResult `xml:"flakyFailure"`
+	SystemOut     string        `xml:"system-out"`
+	SystemErr     string        `xml:"system-err"`
+}
+
+type junitTestSuites struct {
+	Suites []struct {
+		Name  string          `xml:"name,attr"`
+		Cases []junitTestCase `xml:"testcase"`
+	} `xml:"testsuite"`
+}
+
+func parseJUnit(contents string) (*TestReport, error) {
+	var suites junitTestSuites
+
+	if err := xml.Unmarshal([]byte(contents), &suites); err != nil {
+		return nil, fmt.Errorf("parsing JUnit report: %w", err)
+	}
+
+	report := &TestReport{
+		Passed: true,
+	}
+
+	for _, suite := range suites.Suites {
+		for _, c := range suite.Cases {
+			test := TestCase{
+				Suite:  suite.Name,
+				Name:   c.Name,
+				Status: "pass",
+			}
+
+			if c.Time != "" {
+				duration, err := strconv.ParseFloat(c.Time, 64)
+				if err != nil {
+					return nil, fmt.Errorf("parsing duration of %s: %w", c.Name, err)
+				}
+
+				test.Duration = duration
+			}
+
+			switch {
+			case c.Failure != nil || c.Error != nil:
+				test.Status = "fail"
+				test.Output = strings.TrimSpace(c.SystemOut + "\n" + c.SystemErr)
+
+				if test.Output == "" {
+					result := c.Failure
+					if result == nil {
+						result = c.Error
+					}
+
+					test.Output = strings.TrimSpace(result.Message + "\n" + result.Body)
+				}
+
+				report.Passed = false
+
+			case c.Skipped != nil:
+				test.Status = "skip"
+
+			case len(c.FlakyFailures) > 0:
+				test.Status = "flaky"
+			}
+
+			report.Tests = append(report.Tests, test)
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"dagger/rust/internal/dagger"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// Assemble a package into a distributable tarball (.crate file).
+func (m *Rust) Package(
+	ctx context.Context,
+
+	// Package to assemble (required in workspaces with multiple packages).
+	//
+	// +optional
+	pkg string,
+
+	// Do not verify the contents by building them.
+	//
+	// +optional
+	noVerify bool,
+
+	// Feature Selection
+
+	// List of features to activate.
+	//
+	// +optional
+	features []string,
+
+	// Activate all available features.
+	//
+	// +optional
+	allFeatures bool,
+
+	// Do not activate the `default` feature.
+	//
+	// +optional
+	noDefaultFeatures bool,
+) (*dagger.File, error) {
+	builtin := cargoBuiltin{
+		pkg:               pkg,
+		features:          features,
+		allFeatures:       allFeatures,
+		noDefaultFeatures: noDefaultFeatures,
+	}
+
+	// the source is mounted into the container, so uncommitted changes are expected
+	args := append(m.cargo(), "package", "--allow-dirty")
+	args = append(args, builtin.args()...)
+
+	if noVerify {
+		args = append(args, "--no-verify")
+	}
+
+	packageDir := path.Join(m.targetDir(), "package")
+
+	dir := m.container().WithExec(args).Directory(packageDir)
+
+	crates, err := dir.Glob(ctx, "*.crate")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(crates) != 1 {
+		return nil, fmt.Errorf("expected exactly one package, got %d (%s): select a package", len(crates), strings.Join(crates, ", "))
+	}
+
+	return dir.File(crates[0]), nil
+}
+
+// Upload a package to a registry.
+//
+// Packages are published to crates.io by default.
+//
+// +cache="never"
+func (m *Rust) Publish(
+	ctx context.Context,
+
+	// Package to publish (required in workspaces with multiple packages).
+	//
+	// +optional
+	pkg string,
+
+	// Index URL of an alternative registry (e.g., "sparse+https://my-registry.example.com/index/").
+	//
+	// +optional
+	registryUrl string,
+
+	// Name of the alternative registry (must match the registries listed in the "publish" field of the package manifest, if any).
+	//
+	// +optional
+	// +default="custom"
+	registryName string,
+
+	// Authentication token for the registry.
+	//
+	// +optional
+	token *dagger.Secret,
+
+	// Perform all checks without uploading.
+	//
+	// +optional
+	dryRun bool,
+
+	// Do not verify the contents by building them.
+	//
+	// +optional
+	noVerify bool,
+
+	// Feature Selection
+
+	// List of features to activate.
+	//
+	// +optional
+	features []string,
+
+	// Activate all available features.
+	//
+	// +optional
+	allFeatures bool,
+
+	// Do not activate the `default` feature.
+	//
+	// +optional
+	noDefaultFeatures bool,
+) error {
+	if registryName == "" {
+		registryName = "custom"
+	}
+
+	builtin := cargoBuiltin{
+		pkg:               pkg,
+		features:          features,
+		allFeatures:       allFeatures,
+		noDefaultFeatures: noDefaultFeatures,
+	}
+
+	// the source is mounted into the container, so uncommitted changes are expected
+	args := append(m.cargo(), "publish", "--allow-dirty")
+	args = append(args, builtin.args()...)
+
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+
+	if noVerify {
+		args = append(args, "--no-verify")
+	}
+
+	container := m.container()
+
+	if registryUrl != "" {
+		env := "CARGO_REGISTRIES_" + strings.ToUpper(strings.ReplaceAll(registryName, "-", "_"))
+
+		container = container.WithEnvVariable(env+"_INDEX", registryUrl)
+
+		if token != nil {
+			container = container.WithSecretVariable(env+"_TOKEN", token)
+		}
+
+		args = append(args, "--registry", registryName)
+	} else if token != nil {
+		container = container.WithSecretVariable("CARGO_REGISTRY_TOKEN", token)
+	}
+
+	_, err := container.
+		WithEnvVariable("CACHE_BUSTER", time.Now().Format(time.RFC3339Nano)).
+		WithExec(args).
+		Sync(ctx)
+
+	return err
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"dagger/rust/internal/dagger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	gocvss30 "github.com/pandatix/go-cvss/30"
+	gocvss31 "github.com/pandatix/go-cvss/31"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Findings reported by a supply-chain check.
+type Report struct {
+	// Whether the check passed.
+	Passed bool
+
+	// Problems found by the check.
+	Findings []Finding
+}
+
+// A problem reported by a supply-chain check.
+type Finding struct {
+	// Kind of the problem (e.g., vulnerability, unmaintained, yanked or the cargo-deny diagnostic code, such as rejected or banned).
+	Kind string
+
+	// Advisory ID (e.g., "RUSTSEC-2019-0009").
+	//
+	// Empty if the problem is not related to an advisory.
+	Advisory string
+
+	// Name of the affected crate.
+	Crate string
+
+	// Version of the affected crate.
+	Version string
+
+	// Severity derived from the CVSS v3 score of the advisory (critical, high, medium, low or none).
+	//
+	// Empty if the advisory has no (CVSS v3) score.
+	Severity string
+
+	// Description of the problem.
+	Message string
+}
+
+func (f Finding) format() string {
+	crate := f.Crate
+	if f.Version != "" {
+		crate += "@" + f.Version
+	}
+
+	severity := ""
+	if f.Severity != "" {
+		severity = ", " + f.Severity
+	}
+
+	id := f.Advisory
+	if id == "" {
+		id = f.Kind
+	}
+
+	if crate == "" {
+		return fmt.Sprintf("%s (%s%s)", f.Message, id, severity)
+	}
+
+	return fmt.Sprintf("%s: %s (%s%s)", crate, f.Message, id, severity)
+}
+
+// Return an error if the check failed.
+func (r *Report) Check() error {
+	if r.Passed {
+		return nil
+	}
+
+	lines := make([]string, 0, len(r.Findings))
+	for _, finding := range r.Findings {
+		lines = append(lines, finding.format())
+	}
+
+	return fmt.Errorf("%d finding(s):\n%s", len(r.Findings), strings.Join(lines, "\n"))
+}
+
+// Check dependencies for security advisories, license compliance, banned crates and untrusted sources using cargo-deny.
+//
+// +cache="session"
+func (m *Rust) Deny(
+	ctx context.Context,
+
+	// Configuration file (defaults to deny.toml in the source directory).
+	//
+	// +optional
+	config *dagger.File,
+
+	// Checks to run (advisories, bans, licenses, sources).
+	//
+	// +optional
+	checks []string,
+
+	// Advisory database (a clone of https://github.com/rustsec/advisory-db) to use instead of fetching it (e.g., for offline use).
+	//
+	// +optional
+	advisoryDb *dagger.Directory,
+
+	// Version of cargo-deny to install.
+	//
+	// +optional
+	version string,
+) (*Report, error) {
+	const configPath = "/work/deny.toml"
+
+	pkg := "cargo-deny"
+	if version != "" {
+		pkg += "@" + version
+	}
+
+	if advisoryDb != nil {
+		overlay, err := m.offlineDenyConfig(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+
+		config = dag.Directory().WithNewFile("deny.toml", overlay).File("deny.toml")
+	}
+
+	args := []string{"cargo", "deny", "--format", "json", "check"}
+
+	if config != nil {
+		args = append(args, "--config", configPath)
+	}
+
+	if advisoryDb != nil {
+		args = append(args, "--disable-fetch")
+	}
+
+	args = append(args, checks...)
+
+	container := m.Container.
+		WithExec([]string{"cargo", "install", "--locked", pkg}).
+		With(func(c *dagger.Container) *dagger.Container {
+			if config != nil {
+				c = c.WithMountedFile(configPath, config)
+			}
+
+			return c
+		}).
+		WithMountedDirectory(".", m.Source).
+		With(func(c *dagger.Container) *dagger.Container {
+			if advisoryDb == nil {
+				// The advisory database is fetched on every run
+				return c.WithEnvVariable("CACHE_BUSTER", time.Now().Format(time.RFC3339Nano))
+			}
+
+			// cargo-deny names the database directory after its URL: let it clone the local copy
+			return c.
+				WithMountedDirectory(advisoryDbPath, advisoryDb).
+				WithExec([]string{"cargo", "deny", "fetch", "--config", configPath, "db"})
+		}).
+		WithExec(args, dagger.ContainerWithExecOpts{
+			Expect: dagger.ReturnTypeAny,
+		})
+
+	exitCode, err := container.ExitCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// diagnostics are written to stderr
+	stderr, err := container.Stderr(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	findings, err := parseDenyOutput(stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	if exitCode != 0 && len(findings) == 0 {
+		return nil, fmt.Errorf("cargo deny exited with code %d:\n%s", exitCode, stderr)
+	}
+
+	return &Report{
+		Passed:   exitCode == 0,
+		Findings: findings,
+	}, nil
+}
+
+// advisoryDbPath is where a local advisory database is mounted.
+const advisoryDbPath = "/work/advisory-db"
+
+// offlineDenyConfig points the cargo-deny configuration (the given file or deny.toml in the source directory, if any)
+// at the advisory database mounted at advisoryDbPath.
+func (m *Rust) offlineDenyConfig(ctx context.Context, config *dagger.File) (string, error) {
+	if config == nil {
+		exists, err := m.Source.Exists(ctx, "deny.toml")
+		if err != nil {
+			return "", err
+		}
+
+		if exists {
+			config = m.Source.File("deny.toml")
+		}
+	}
+
+	settings := map[string]any{}
+
+	if config != nil {
+		contents, err := config.Contents(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		if err := toml.Unmarshal([]byte(contents), &settings); err != nil {
+			return "", fmt.Errorf("parsing cargo-deny configuration: %w", err)
+		}
+	}
+
+	advisories, _ := settings["advisories"].(map[string]any)
+	if advisories == nil {
+		advisories = map[string]any{}
+	}
+
+	advisories["db-path"] = "/work/advisory-dbs"
+	advisories["db-urls"] = []string{"file://" + advisoryDbPath}
+	settings["advisories"] = advisories
+
+	overlay, err := toml.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+
+	return string(overlay), nil
+}
+
+// advisory is the JSON format of RustSec advisories (as reported by cargo-deny and cargo-audit).
+type advisory struct {
+	ID      string  `json:"id"`
+	Package string  `json:"package"`
+	Title   string  `json:"title"`
+	CVSS    *string `json:"cvss"`
+}
+
+func (a *advisory) severity() string {
+	if a == nil || a.CVSS == nil {
+		return ""
+	}
+
+	return cvssSeverity(*a.CVSS)
+}
+
+// parseDenyOutput parses the output of "cargo deny --format json": a JSON object per line.
+func parseDenyOutput(output string) ([]Finding, error) {
+	var findings []Finding
+
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		var message struct {
+			Type   string `json:"type"`
+			Fields struct {
+				Severity string `json:"severity"`
+				Code     string `json:"code"`
+				Message  string `json:"message"`
+				Graphs   []struct {
+					Krate struct {
+						Name    string `json:"name"`
+						Version string `json:"version"`
+					} `json:"Krate"`
+				} `json:"graphs"`
+				Advisory *advisory `json:"advisory"`
+			} `json:"fields"`
+		}
+
+		if err := json.Unmarshal([]byte(line), &message); err != nil {
+			return nil, fmt.Errorf("parsing cargo deny output: %w", err)
+		}
+
+		if message.Type != "diagnostic" || (message.Fields.Severity != "error" && message.Fields.Severity != "warning") {
+			continue
+		}
+
+		finding := Finding{
+			Kind:     message.Fields.Code,
+			Severity: message.Fields.Advisory.severity(),
+			Message:  message.Fields.Message,
+		}
+
+		if message.Fields.Advisory != nil {
+			finding.Advisory = message.Fields.Advisory.ID
+		}
+
+		if len(message.Fields.Graphs) > 0 {
+			finding.Crate = message.Fields.Graphs[0].Krate.Name
+			finding.Version = message.Fields.Graphs[0].Krate.Version
+		}
+
+		findings = append(findings, finding)
+	}
+
+	sortFindings(findings)
+
+	return findings, nil
+}
+
+// Audit Cargo.lock for crates with security vulnerabilities (and other advisories) using cargo-audit.
+//
+// Warnings (e.g., unmaintained or yanked crates) are reported as findings, but do not fail the check.
+//
+// +cache="session"
+func (m *Rust) Audit(
+	ctx context.Context,
+
+	// Advisory database (a clone of https://github.com/rustsec/advisory-db) to use instead of fetching it (e.g., for offline use).
+	//
+	// +optional
+	advisoryDb *dagger.Directory,
+
+	// Advisory IDs to ignore.
+	//
+	// +optional
+	ignore []string,
+
+	// Version of cargo-audit to install.
+	//
+	// +optional
+	version string,
+) (*Report, error) {
+	pkg := "cargo-audit"
+	if version != "" {
+		pkg += "@" + version
+	}
+
+	args := []string{"cargo", "audit", "--json"}
+
+	if advisoryDb != nil {
+		args = append(args, "--db", advisoryDbPath, "--no-fetch")
+	}
+
+	for _, id := range ignore {
+		args = append(args, "--ignore", id)
+	}
+
+	container := m.Container.
+		WithExec([]string{"cargo", "install", "--locked", pkg}).
+		With(func(c *dagger.Container) *dagger.Container {
+			if advisoryDb != nil {
+				c = c.WithMountedDirectory(advisoryDbPath, advisoryDb)
+			} else {
+				// The advisory database is fetched on every run
+				c = c.WithEnvVariable("CACHE_BUSTER", time.Now().Format(time.RFC3339Nano))
+			}
+
+			return c
+		}).
+		WithMountedDirectory(".", m.Source).
+		WithExec(args, dagger.ContainerWithExecOpts{
+			Expect: dagger.ReturnTypeAny,
+		})
+
+	exitCode, err := container.ExitCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := container.Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	findings, err := parseAuditOutput(stdout)
+	if err != nil {
+		stderr, serr := container.Stderr(ctx)
+		if serr != nil {
+			return nil, serr
+		}
+
+		return nil, fmt.Errorf("cargo audit exited with code %d:\n%s", exitCode, stderr)
+	}
+
+	return &Report{
+		Passed:   exitCode == 0,
+		Findings: findings,
+	}, nil
+}
+
+// parseAuditOutput parses the output of "cargo audit --json".
+func parseAuditOutput(output string) ([]Finding, error) {
+	type warning struct {
+		Kind    string `json:"kind"`
+		Package struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"package"`
+		Advisory *advisory `json:"advisory"`
+	}
+
+	var report struct {
+		Vulnerabilities struct {
+			List []struct {
+				Advisory advisory `json:"advisory"`
+				Package  struct {
+					Name    string `json:"name"`
+					Version string `json:"version"`
+				} `json:"package"`
+				Versions struct {
+					Patched []string `json:"patched"`
+				} `json:"versions"`
+			} `json:"list"`
+		} `json:"vulnerabilities"`
+		Warnings map[string][]warning `json:"warnings"`
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(output))
+
+	if err := decoder.Decode(&report); errors.Is(err, io.EOF) {
+		return nil, errors.New("parsing cargo audit output: empty output")
+	} else if err != nil {
+		return nil, fmt.Errorf("parsing cargo audit output: %w", err)
+	}
+
+	var findings []Finding
+
+	for _, vulnerability := range report.Vulnerabilities.List {
+		message := vulnerability.Advisory.Title
+
+		if len(vulnerability.Versions.Patched) > 0 {
+			message += fmt.Sprintf(" (patched: %s)", strings.Join(vulnerability.Versions.Patched, ", "))
+		} else {
+			message += " (no patched version available)"
+		}
+
+		findings = append(findings, Finding{
+			Kind:     "vulnerability",
+			Advisory: vulnerability.Advisory.ID,
+			Crate:    vulnerability.Package.Name,
+			Version:  vulnerability.Package.Version,
+			Severity: vulnerability.Advisory.severity(),
+			Message:  message,
+		})
+	}
+
+	for _, warnings := range report.Warnings {
+		for _, warning := range warnings {
+			finding := Finding{
+				Kind:    warning.Kind,
+				Crate:   warning.Package.Name,
+				Version: warning.Package.Version,
+				Message: warning.Kind,
+			}
+
+			if warning.Advisory != nil {
+				finding.Advisory = warning.Advisory.ID
+				finding.Severity = warning.Advisory.severity()
+				finding.Message = warning.Advisory.Title
+			}
+
+			findings = append(findings, finding)
+		}
+	}
+
+	sortFindings(findings)
+
+	return findings, nil
+}
+
+func sortFindings(findings []Finding) {
+	slices.SortFunc(findings, func(a, b Finding) int {
+		if c := strings.Compare(a.Crate, b.Crate); c != 0 {
+			return c
+		}
+
+		if c := strings.Compare(a.Version, b.Version); c != 0 {
+			return c
+		}
+
+		if c := strings.Compare(a.Advisory, b.Advisory); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Kind, b.Kind)
+	})
+}
+
+// cvssSeverity computes the qualitative severity rating of a CVSS v3 vector (e.g., "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H").
+//
+// Returns an empty string for other versions and invalid vectors.
+func cvssSeverity(vector string) string {
+	var score float64
+
+	switch {
+	case strings.HasPrefix(vector, "CVSS:3.0/"):
+		cvss, err := gocvss30.ParseVector(vector)
+		if err != nil {
+			return ""
+		}
+
+		score = cvss.BaseScore()
+
+	case strings.HasPrefix(vector, "CVSS:3.1/"):
+		cvss, err := gocvss31.ParseVector(vector)
+		if err != nil {
+			return ""
+		}
+
+		score = cvss.BaseScore()
+
+	default:
+		return ""
+	}
+
+	// the rating scale is the same in both versions
+	rating, err := gocvss31.Rating(score)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(rating)
+}
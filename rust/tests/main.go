@@ -3,6 +3,10 @@ package main
 import (
 	"context"
 	"dagger/rust/tests/internal/dagger"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 
 	"github.com/sourcegraph/conc/pool"
 )
@@ -15,12 +19,30 @@ func (m *Tests) All(ctx context.Context) error {
 
 	p.Go(m.Build)
 	p.Go(m.BuildWithChef)
+	p.Go(m.TestWithChef)
+	p.Go(m.CheckWithChef)
+	p.Go(m.BuildCrossTarget)
+	p.Go(m.BuildMatrix)
 	p.Go(m.Test)
+	p.Go(m.Nextest)
+	p.Go(m.Nextest_Failure)
+	p.Go(m.Nextest_Partition)
+	p.Go(m.Nextest_RepositoryConfig)
+	p.Go(m.Coverage)
+	p.Go(m.Coverage_Html)
+	p.Go(m.Deny)
+	p.Go(m.Deny_Offline)
+	p.Go(m.Audit)
+	p.Go(m.Audit_Vulnerable)
 	p.Go(m.Check)
 	p.Go(m.Format)
 	p.Go(m.FormatCheck)
 	p.Go(m.Clippy)
 	p.Go(m.ClippyFix)
+	p.Go(m.ClippyDiagnostics)
+	p.Go(m.ClippyFix_Lints)
+	p.Go(m.Package)
+	p.Go(m.Publish)
 
 	return p.Wait()
 }
@@ -40,11 +62,62 @@ func (m *Tests) Build(ctx context.Context) error {
 func (m *Tests) BuildWithChef(ctx context.Context) error {
 	rust := m.module()
 
-	_, err := rust.WithChef().Build().Sync(ctx)
+	_, err := rust.WithChef().
+		Build(dagger.RustBuildOpts{Release: true}).
+		File("release/testdata").
+		Sync(ctx)
 
 	return err
 }
 
+func (m *Tests) TestWithChef(ctx context.Context) error {
+	rust := m.module()
+
+	_, err := rust.WithChef().Test().Sync(ctx)
+
+	return err
+}
+
+func (m *Tests) CheckWithChef(ctx context.Context) error {
+	rust := m.module()
+
+	_, err := rust.WithChef().Check().Sync(ctx)
+
+	return err
+}
+
+func (m *Tests) BuildCrossTarget(ctx context.Context) error {
+	rust := m.module()
+
+	_, err := rust.WithCrossTarget("aarch64-unknown-linux-musl").
+		Build(dagger.RustBuildOpts{Target: "aarch64-unknown-linux-musl"}).
+		File("aarch64-unknown-linux-musl/debug/testdata").
+		Sync(ctx)
+
+	return err
+}
+
+func (m *Tests) BuildMatrix(ctx context.Context) error {
+	rust := m.module()
+
+	entries, err := rust.
+		BuildMatrix([]string{"aarch64-unknown-linux-musl", "x86_64-pc-windows-gnu"}, dagger.RustBuildMatrixOpts{
+			Release: true,
+		}).
+		Glob(ctx, "*/*")
+	if err != nil {
+		return err
+	}
+
+	expected := []string{"aarch64-unknown-linux-musl/testdata", "x86_64-pc-windows-gnu/testdata.exe"}
+
+	if !reflect.DeepEqual(entries, expected) {
+		return fmt.Errorf("unexpected binaries: wanted %v, got %v", expected, entries)
+	}
+
+	return nil
+}
+
 func (m *Tests) Test(ctx context.Context) error {
 	rust := m.module()
 
@@ -53,6 +126,272 @@ func (m *Tests) Test(ctx context.Context) error {
 	return err
 }
 
+func (m *Tests) Nextest(ctx context.Context) error {
+	rust := m.module()
+
+	report := rust.Nextest().Run()
+
+	err := report.Check(ctx)
+	if err != nil {
+		return err
+	}
+
+	tests, err := report.Tests(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(tests) != 1 {
+		return fmt.Errorf("expected exactly one test, got %d", len(tests))
+	}
+
+	name, err := tests[0].Name(ctx)
+	if err != nil {
+		return err
+	}
+
+	if name != "tests::test_test" {
+		return fmt.Errorf("unexpected test name: wanted \"tests::test_test\", got %q", name)
+	}
+
+	_, err = report.Junit().Sync(ctx)
+
+	return err
+}
+
+func (m *Tests) Nextest_Failure(ctx context.Context) error {
+	source := dag.CurrentModule().Source().Directory("testdata").
+		WithNewFile("tests/fail.rs", `#[test]
+fn failing() {
+    println!("some output");
+    assert_eq!(1, 2);
+}
+`)
+
+	report := dag.Rust(source).Nextest().Run()
+
+	passed, err := report.Passed(ctx)
+	if err != nil {
+		return err
+	}
+
+	if passed {
+		return errors.New("expected tests to fail")
+	}
+
+	err = report.Check(ctx)
+	if err == nil {
+		return errors.New("expected check to fail")
+	}
+
+	if !strings.Contains(err.Error(), "some output") {
+		return fmt.Errorf("expected error to contain the output of the failing test, got %q", err)
+	}
+
+	return nil
+}
+
+// The configuration of the repository (including custom profiles) is extended rather than replaced.
+func (m *Tests) Nextest_RepositoryConfig(ctx context.Context) error {
+	source := dag.CurrentModule().Source().Directory("testdata").
+		WithNewFile(".config/nextest.toml", `[profile.default]
+slow-timeout = "30s"
+
+[profile.dagger]
+retries = 1
+
+[profile.dagger.junit]
+path = "custom.xml"
+`)
+
+	return dag.Rust(source).Nextest().Run().Check(ctx)
+}
+
+func (m *Tests) Nextest_Partition(ctx context.Context) error {
+	rust := m.module()
+
+	p := pool.New().WithErrors().WithContext(ctx)
+
+	var total [2]int
+
+	for i := range 2 {
+		p.Go(func(ctx context.Context) error {
+			tests, err := rust.Nextest().
+				Run(dagger.RustNextestRunOpts{Partition: fmt.Sprintf("count:%d/2", i+1)}).
+				Tests(ctx)
+			if err != nil {
+				return err
+			}
+
+			total[i] = len(tests)
+
+			return nil
+		})
+	}
+
+	if err := p.Wait(); err != nil {
+		return err
+	}
+
+	if total[0]+total[1] != 1 {
+		return fmt.Errorf("expected exactly one test across partitions, got %d", total[0]+total[1])
+	}
+
+	return nil
+}
+
+func (m *Tests) Coverage(ctx context.Context) error {
+	rust := m.module()
+
+	report := rust.Coverage()
+
+	lines, err := report.Lines(ctx)
+	if err != nil {
+		return err
+	}
+
+	if lines <= 0 {
+		return fmt.Errorf("expected positive line coverage, got %f", lines)
+	}
+
+	contents, err := report.File().Contents(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(contents, "SF:") {
+		return fmt.Errorf("expected lcov report, got %q", contents)
+	}
+
+	return nil
+}
+
+func (m *Tests) Coverage_Html(ctx context.Context) error {
+	rust := m.module()
+
+	_, err := rust.Coverage(dagger.RustCoverageOpts{Format: "html"}).
+		Directory().
+		File("index.html").
+		Sync(ctx)
+
+	return err
+}
+
+func (m *Tests) Deny(ctx context.Context) error {
+	rust := m.module()
+
+	return rust.Deny(dagger.RustDenyOpts{Checks: []string{"advisories", "bans", "sources"}}).Check(ctx)
+}
+
+func (m *Tests) Deny_Offline(ctx context.Context) error {
+	// the lock file is generated by cargo-deny (when reading the metadata)
+	source := dag.CurrentModule().Source().Directory("testdata").
+		WithoutFile("Cargo.lock").
+		WithNewFile("Cargo.toml", `[package]
+name = "testdata"
+version = "0.1.0"
+edition = "2024"
+
+[dependencies]
+smallvec = "=0.6.9"
+`)
+
+	advisoryDb := dag.Git("https://github.com/rustsec/advisory-db.git").Branch("main").Tree()
+
+	report := dag.Rust(source).Deny(dagger.RustDenyOpts{
+		Checks:     []string{"advisories"},
+		AdvisoryDb: advisoryDb,
+	})
+
+	passed, err := report.Passed(ctx)
+	if err != nil {
+		return err
+	}
+
+	if passed {
+		return errors.New("expected deny to fail")
+	}
+
+	findings, err := report.Findings(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, finding := range findings {
+		id, err := finding.Advisory(ctx)
+		if err != nil {
+			return err
+		}
+
+		if id == "RUSTSEC-2019-0009" {
+			return nil
+		}
+	}
+
+	return errors.New("expected RUSTSEC-2019-0009 to be reported")
+}
+
+func (m *Tests) Audit(ctx context.Context) error {
+	rust := m.module()
+
+	return rust.Audit().Check(ctx)
+}
+
+func (m *Tests) Audit_Vulnerable(ctx context.Context) error {
+	// cargo-audit only reads Cargo.lock
+	source := dag.CurrentModule().Source().Directory("testdata").
+		WithNewFile("Cargo.lock", `version = 4
+
+[[package]]
+name = "smallvec"
+version = "0.6.9"
+source = "registry+https://github.com/rust-lang/crates.io-index"
+
+[[package]]
+name = "testdata"
+version = "0.1.0"
+dependencies = [
+ "smallvec",
+]
+`)
+
+	advisoryDb := dag.Git("https://github.com/rustsec/advisory-db.git").Branch("main").Tree()
+
+	report := dag.Rust(source).Audit(dagger.RustAuditOpts{AdvisoryDb: advisoryDb})
+
+	passed, err := report.Passed(ctx)
+	if err != nil {
+		return err
+	}
+
+	if passed {
+		return errors.New("expected audit to fail")
+	}
+
+	findings, err := report.Findings(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, finding := range findings {
+		id, err := finding.Advisory(ctx)
+		if err != nil {
+			return err
+		}
+
+		crate, err := finding.Crate(ctx)
+		if err != nil {
+			return err
+		}
+
+		if id == "RUSTSEC-2019-0009" && crate == "smallvec" {
+			return nil
+		}
+	}
+
+	return errors.New("expected RUSTSEC-2019-0009 to be reported for smallvec")
+}
+
 func (m *Tests) Check(ctx context.Context) error {
 	rust := m.module()
 
@@ -92,3 +431,209 @@ func (m *Tests) ClippyFix(ctx context.Context) error {
 
 	return err
 }
+
+// clippySource returns a source that triggers the clippy::needless_return lint.
+func (m *Tests) clippySource() *dagger.Directory {
+	return dag.CurrentModule().Source().Directory("testdata").
+		WithNewFile("src/main.rs", `fn answer() -> i32 {
+    return 42;
+}
+
+fn main() {
+    println!("{}", answer());
+}
+`)
+}
+
+func (m *Tests) ClippyDiagnostics(ctx context.Context) error {
+	report := dag.Rust(m.clippySource()).
+		Clippy(dagger.RustClippyOpts{DenyWarnings: true}).
+		Diagnostics()
+
+	passed, err := report.Passed(ctx)
+	if err != nil {
+		return err
+	}
+
+	if passed {
+		return errors.New("expected clippy to fail")
+	}
+
+	diagnostics, err := report.Diagnostics(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(diagnostics) != 1 {
+		return fmt.Errorf("expected exactly one diagnostic, got %d", len(diagnostics))
+	}
+
+	lint, err := diagnostics[0].Lint(ctx)
+	if err != nil {
+		return err
+	}
+
+	if lint != "clippy::needless_return" {
+		return fmt.Errorf("unexpected lint: wanted \"clippy::needless_return\", got %q", lint)
+	}
+
+	sarif, err := report.Sarif().Contents(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(sarif, `"ruleId": "clippy::needless_return"`) {
+		return fmt.Errorf("expected SARIF report to contain the lint, got %q", sarif)
+	}
+
+	// allowing the lint makes the check pass
+	return dag.Rust(m.clippySource()).
+		Clippy(dagger.RustClippyOpts{
+			Allow:        []string{"clippy::needless_return"},
+			DenyWarnings: true,
+		}).
+		Diagnostics().
+		Check(ctx)
+}
+
+func (m *Tests) ClippyFix_Lints(ctx context.Context) error {
+	modified, err := dag.Rust(m.clippySource()).
+		Clippy().
+		Fix().
+		ModifiedPaths(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(modified, []string{"src/main.rs"}) {
+		return fmt.Errorf("expected src/main.rs to be fixed, got %v", modified)
+	}
+
+	return nil
+}
+
+func (m *Tests) Package(ctx context.Context) error {
+	rust := m.module()
+
+	name, err := rust.Package().Name(ctx)
+	if err != nil {
+		return err
+	}
+
+	if name != "testdata-0.1.0.crate" {
+		return fmt.Errorf("unexpected package name: wanted \"testdata-0.1.0.crate\", got %q", name)
+	}
+
+	return nil
+}
+
+// registryServer implements the parts of the sparse index and the publish API of a Cargo registry needed for publishing.
+const registryServer = `import hashlib
+import json
+import os
+import struct
+from http.server import HTTPServer, SimpleHTTPRequestHandler
+
+ROOT = "/registry"
+
+
+def index_path(name):
+    name = name.lower()
+    if len(name) <= 2:
+        return os.path.join(str(len(name)), name)
+    if len(name) == 3:
+        return os.path.join("3", name[0], name)
+    return os.path.join(name[0:2], name[2:4], name)
+
+
+class Handler(SimpleHTTPRequestHandler):
+    def __init__(self, *args, **kwargs):
+        super().__init__(*args, directory=ROOT, **kwargs)
+
+    def do_PUT(self):
+        if self.path != "/api/v1/crates/new":
+            self.send_error(404)
+            return
+
+        body = self.rfile.read(int(self.headers["Content-Length"]))
+        (meta_len,) = struct.unpack("<I", body[0:4])
+        meta = json.loads(body[4 : 4 + meta_len])
+        (crate_len,) = struct.unpack("<I", body[4 + meta_len : 8 + meta_len])
+        crate = body[8 + meta_len : 8 + meta_len + crate_len]
+
+        os.makedirs(os.path.join(ROOT, "crates", meta["name"]), exist_ok=True)
+        with open(os.path.join(ROOT, "crates", meta["name"], meta["vers"] + ".crate"), "wb") as f:
+            f.write(crate)
+
+        entry = {
+            "name": meta["name"],
+            "vers": meta["vers"],
+            "deps": [],
+            "cksum": hashlib.sha256(crate).hexdigest(),
+            "features": meta.get("features", {}),
+            "yanked": False,
+        }
+
+        path = os.path.join(ROOT, "index", index_path(meta["name"]))
+        os.makedirs(os.path.dirname(path), exist_ok=True)
+        with open(path, "a") as f:
+            f.write(json.dumps(entry) + "\n")
+
+        response = json.dumps({"warnings": {"invalid_categories": [], "invalid_badges": [], "other": []}}).encode()
+        self.send_response(200)
+        self.send_header("Content-Type", "application/json")
+        self.send_header("Content-Length", str(len(response)))
+        self.end_headers()
+        self.wfile.write(response)
+
+
+HTTPServer(("0.0.0.0", 8080), Handler).serve_forever()
+`
+
+func (m *Tests) Publish(ctx context.Context) error {
+	registry, err := dag.Container().
+		From("python:3-alpine").
+		WithNewFile("/registry/index/config.json", `{"dl": "http://registry:8080/crates/{crate}/{version}.crate", "api": "http://registry:8080"}`).
+		WithNewFile("/server.py", registryServer).
+		WithExposedPort(8080).
+		AsService(dagger.ContainerAsServiceOpts{Args: []string{"python", "/server.py"}}).
+		Start(ctx)
+	if err != nil {
+		return err
+	}
+	defer registry.Stop(ctx)
+
+	rust := m.module().WithServiceBinding("registry", registry)
+
+	opts := dagger.RustPublishOpts{
+		RegistryURL: "sparse+http://registry:8080/index/",
+		Token:       dag.SetSecret("registry-token", "secret"),
+	}
+
+	dryRunOpts := opts
+	dryRunOpts.DryRun = true
+	dryRunOpts.NoDefaultFeatures = true
+
+	if err := rust.Publish(ctx, dryRunOpts); err != nil {
+		return err
+	}
+
+	if err := rust.Publish(ctx, opts); err != nil {
+		return err
+	}
+
+	index, err := dag.Container().
+		From("alpine:latest").
+		WithServiceBinding("registry", registry).
+		WithExec([]string{"wget", "-qO-", "http://registry:8080/index/te/st/testdata"}).
+		Stdout(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(index, `"vers": "0.1.0"`) {
+		return fmt.Errorf("expected published version in the index, got %q", index)
+	}
+
+	return nil
+}